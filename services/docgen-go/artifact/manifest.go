@@ -0,0 +1,116 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const manifestFilename = "manifest.json"
+
+// ManifestEntry records where a logical filename's bytes live in the
+// shared blob store and how large they are.
+type ManifestEntry struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest maps a filename within an artifact bundle to its blob entry.
+type Manifest map[string]ManifestEntry
+
+func (a *Artifact) manifestPath() string {
+	return filepath.Join(a.Path, manifestFilename)
+}
+
+func (a *Artifact) loadManifest() (Manifest, error) {
+	data, err := os.ReadFile(a.manifestPath())
+	if os.IsNotExist(err) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (a *Artifact) saveManifest(manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.manifestPath(), data, 0644)
+}
+
+// GetManifest returns the full manifest for an artifact, e.g. to serve
+// GET /v1/docgen/files/{id}/manifest.json.
+func (s *Store) GetManifest(id string) (Manifest, error) {
+	art := &Artifact{ID: id, Path: filepath.Join(s.basePath, id), store: s}
+	manifest, err := art.loadManifest()
+	if err != nil {
+		return nil, fmt.Errorf("manifest not found for artifact %s: %w", id, err)
+	}
+	return manifest, nil
+}
+
+// GetManifestEntry looks up a single filename's manifest entry, e.g. to
+// serve a HEAD request's Docker-Content-Digest/ETag headers.
+func (s *Store) GetManifestEntry(id, filename string) (ManifestEntry, error) {
+	manifest, err := s.GetManifest(id)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	entry, ok := manifest[filename]
+	if !ok {
+		return ManifestEntry{}, fmt.Errorf("artifact not found: %s/%s", id, filename)
+	}
+	return entry, nil
+}
+
+func (s *Store) blobPath(digest string) string {
+	return filepath.Join(s.basePath, blobsDirName, blobsAlgoDir, digest)
+}
+
+// putBlob hashes data while streaming it to a temp file, then commits
+// the temp file into the content-addressed blob directory under its
+// digest. If a blob with that digest already exists, the write is
+// deduped and the temp file discarded.
+func (s *Store) putBlob(data []byte) (digest string, size int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.basePath, blobsDirName), "upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp blob: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once successfully renamed below
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), bytes.NewReader(data))
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if closeErr != nil {
+		return "", 0, fmt.Errorf("failed to close temp blob: %w", closeErr)
+	}
+
+	digest = hex.EncodeToString(h.Sum(nil))
+	finalPath := s.blobPath(digest)
+
+	if _, err := os.Stat(finalPath); err == nil {
+		return digest, n, nil
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return "", 0, fmt.Errorf("failed to commit blob: %w", err)
+	}
+	return digest, n, nil
+}
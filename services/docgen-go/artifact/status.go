@@ -0,0 +1,63 @@
+package artifact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const statusFilename = "status.json"
+
+// JobStatus records the state of a background /jobs generation run.
+// Sections maps prompt ID to a completion percentage: 0 while pending,
+// 100 once written, or -1 on error. Progress is necessarily 0/100 rather
+// than continuous, since each prompt resolves as a single atomic
+// completion call rather than exposing token-level progress.
+type JobStatus struct {
+	State     string         `json:"state"` // "running", "complete", "error"
+	Sections  map[string]int `json:"sections,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func (a *Artifact) statusPath() string {
+	return filepath.Join(a.Path, statusFilename)
+}
+
+// SaveStatus persists status to the artifact's status.json and bumps
+// the artifact directory's mtime, so the janitor's TTL resets on every
+// progress update instead of expiring out from under a still-running job.
+func (a *Artifact) SaveStatus(status JobStatus) error {
+	status.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job status: %w", err)
+	}
+	if err := os.WriteFile(a.statusPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write job status: %w", err)
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(a.Path, now, now); err != nil {
+		return fmt.Errorf("failed to refresh artifact mtime: %w", err)
+	}
+	return nil
+}
+
+// Status returns the current JobStatus for an artifact, e.g. to serve
+// GET /v1/docgen/jobs/{id}.
+func (s *Store) Status(id string) (JobStatus, error) {
+	art := &Artifact{ID: id, Path: filepath.Join(s.basePath, id), store: s}
+
+	data, err := os.ReadFile(art.statusPath())
+	if err != nil {
+		return JobStatus{}, fmt.Errorf("status not found for job %s: %w", id, err)
+	}
+
+	var status JobStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return JobStatus{}, fmt.Errorf("failed to parse status for job %s: %w", id, err)
+	}
+	return status, nil
+}
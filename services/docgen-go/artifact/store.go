@@ -2,19 +2,28 @@ package artifact
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"services/docgen-go/internal/metrics"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
-	defaultTTL = 15 * time.Minute
+	defaultTTL   = 15 * time.Minute
+	blobsDirName = "blobs"
+	blobsAlgoDir = "sha256"
 )
 
-// Store manages artifacts on the filesystem.
+// Store manages artifacts on the filesystem. Artifact contents are
+// stored content-addressably under a shared blobs/ directory so
+// near-identical bundles (e.g. repeat exports of the same design doc)
+// don't duplicate bytes on disk; each artifact directory holds a
+// manifest.json mapping filename to digest/size, plus untracked files
+// such as a job's status.json or an in-progress upload (see GetFilePath).
 type Store struct {
 	basePath string
 	ttl      time.Duration
@@ -22,8 +31,9 @@ type Store struct {
 
 // Artifact represents a single generated artifact bundle.
 type Artifact struct {
-	ID   string
-	Path string
+	ID    string
+	Path  string
+	store *Store
 }
 
 // NewStore creates a new artifact store.
@@ -31,6 +41,9 @@ func NewStore(basePath string) (*Store, error) {
 	if err := os.MkdirAll(basePath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create artifact base path: %w", err)
 	}
+	if err := os.MkdirAll(filepath.Join(basePath, blobsDirName, blobsAlgoDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blobs directory: %w", err)
+	}
 	return &Store{
 		basePath: basePath,
 		ttl:      defaultTTL,
@@ -47,21 +60,37 @@ func (s *Store) CreateNew() (*Artifact, error) {
 	}
 
 	return &Artifact{
-		ID:   id,
-		Path: path,
+		ID:    id,
+		Path:  path,
+		store: s,
 	}, nil
 }
 
-// WriteFile writes a file to the artifact's directory.
+// WriteFile stores data content-addressably under the shared blobs
+// directory (deduping against any existing blob with the same digest)
+// and records filename -> digest/size in the artifact's manifest. It
+// returns the digest.
 func (a *Artifact) WriteFile(filename string, data []byte) (string, error) {
-	path := filepath.Join(a.Path, filename)
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	digest, size, err := a.store.putBlob(data)
+	if err != nil {
 		return "", fmt.Errorf("failed to write artifact file: %w", err)
 	}
-	return path, nil
+
+	manifest, err := a.loadManifest()
+	if err != nil {
+		return "", fmt.Errorf("failed to load manifest: %w", err)
+	}
+	manifest[filename] = ManifestEntry{Digest: digest, Size: size}
+	if err := a.saveManifest(manifest); err != nil {
+		return "", fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	return digest, nil
 }
 
-// GetFilePath returns the full path for a given filename within the artifact.
+// GetFilePath returns a scratch path within the artifact's own directory,
+// for content that isn't (yet) tracked by the manifest - e.g. the raw
+// bytes of an in-progress chunked upload.
 func (a *Artifact) GetFilePath(filename string) string {
 	return filepath.Join(a.Path, filename)
 }
@@ -76,40 +105,122 @@ func (s *Store) StartJanitor(interval time.Duration) {
 	}()
 }
 
+// cleanup removes artifact directories past their TTL, then garbage
+// collects any blob no longer referenced by a surviving artifact's
+// manifest.
 func (s *Store) cleanup() {
 	slog.Info("Running artifact cleanup janitor...")
-	files, err := os.ReadDir(s.basePath)
+	entries, err := os.ReadDir(s.basePath)
 	if err != nil {
 		slog.Error("failed to read artifact directory for cleanup", "error", err)
 		return
 	}
 
-	for _, file := range files {
-		if !file.IsDir() {
+	liveDigests := make(map[string]bool)
+	artifactCount := 0
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == blobsDirName {
 			continue
 		}
 
-		info, err := file.Info()
+		info, err := entry.Info()
 		if err != nil {
-			slog.Error("failed to get file info for cleanup", "error", err, "file", file.Name())
+			slog.Error("failed to get file info for cleanup", "error", err, "file", entry.Name())
 			continue
 		}
 
+		artPath := filepath.Join(s.basePath, entry.Name())
+
 		if time.Since(info.ModTime()) > s.ttl {
-			path := filepath.Join(s.basePath, file.Name())
-			slog.Info("Deleting expired artifact directory", "path", path)
-			if err := os.RemoveAll(path); err != nil {
-				slog.Error("failed to delete expired artifact", "error", err, "path", path)
+			slog.Info("Deleting expired artifact directory", "path", artPath)
+			if err := os.RemoveAll(artPath); err != nil {
+				slog.Error("failed to delete expired artifact", "error", err, "path", artPath)
+			} else {
+				metrics.JanitorEvictionsTotal.Inc()
 			}
+			continue
+		}
+
+		artifactCount++
+
+		art := &Artifact{ID: entry.Name(), Path: artPath, store: s}
+		manifest, err := art.loadManifest()
+		if err != nil {
+			slog.Warn("failed to read manifest during cleanup", "error", err, "id", entry.Name())
+			continue
+		}
+		for _, e := range manifest {
+			liveDigests[e.Digest] = true
 		}
 	}
+
+	metrics.ArtifactCount.Set(float64(artifactCount))
+	s.gcBlobs(liveDigests)
 }
 
-// GetArtifactPath returns the path to an artifact directory if it exists.
+// gcBlobs removes any blob not in live. This is reachability-based GC
+// computed fresh from every surviving artifact's manifest each run,
+// rather than an in-memory refcount that wouldn't survive a restart.
+func (s *Store) gcBlobs(live map[string]bool) {
+	blobDir := filepath.Join(s.basePath, blobsDirName, blobsAlgoDir)
+	files, err := os.ReadDir(blobDir)
+	if err != nil {
+		slog.Error("failed to read blobs directory for cleanup", "error", err)
+		return
+	}
+
+	var totalBytes int64
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if !live[f.Name()] {
+			path := filepath.Join(blobDir, f.Name())
+			slog.Info("Garbage collecting unreferenced blob", "path", path)
+			if err := os.Remove(path); err != nil {
+				slog.Error("failed to remove unreferenced blob", "error", err, "path", path)
+			}
+			continue
+		}
+		if info, err := f.Info(); err == nil {
+			totalBytes += info.Size()
+		}
+	}
+
+	metrics.ArtifactBytes.Set(float64(totalBytes))
+}
+
+// GetArtifactPath resolves filename to its on-disk blob path via the
+// artifact's manifest.
 func (s *Store) GetArtifactPath(id, filename string) (string, error) {
-	path := filepath.Join(s.basePath, id, filename)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return "", fmt.Errorf("artifact not found: %s/%s", id, filename)
+	entry, err := s.GetManifestEntry(id, filename)
+	if err != nil {
+		return "", err
 	}
-	return path, nil
+	return s.blobPath(entry.Digest), nil
+}
+
+// OpenForRead opens filename within artifact id for random-access
+// reading, so a handler can honor a Range header without loading the
+// whole blob into memory. The caller is responsible for closing the
+// returned ReadSeeker (it is always an *os.File under the hood).
+func (s *Store) OpenForRead(id, filename string) (io.ReadSeeker, os.FileInfo, error) {
+	path, err := s.GetArtifactPath(id, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open artifact file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to stat artifact file: %w", err)
+	}
+
+	return f, info, nil
 }
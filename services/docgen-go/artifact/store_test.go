@@ -2,6 +2,7 @@ package artifact
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -29,18 +30,123 @@ func TestArtifactStore(t *testing.T) {
 	t.Run("WriteFile", func(t *testing.T) {
 		art, _ := store.CreateNew()
 		testData := []byte("hello world")
-		path, err := art.WriteFile("test.txt", testData)
+		digest, err := art.WriteFile("test.txt", testData)
 		if err != nil {
 			t.Fatalf("Failed to write file: %v", err)
 		}
+		if digest == "" {
+			t.Fatal("Expected a non-empty digest")
+		}
+
+		path, err := store.GetArtifactPath(art.ID, "test.txt")
+		if err != nil {
+			t.Fatalf("Failed to resolve artifact path: %v", err)
+		}
 		if _, err := os.Stat(path); os.IsNotExist(err) {
-			t.Errorf("Expected file to be created at %s", path)
+			t.Errorf("Expected blob to be created at %s", path)
 		}
 		data, _ := os.ReadFile(path)
 		if string(data) != "hello world" {
 			t.Errorf("Expected file content to be 'hello world', got '%s'", string(data))
 		}
+
+		entry, err := store.GetManifestEntry(art.ID, "test.txt")
+		if err != nil {
+			t.Fatalf("Failed to get manifest entry: %v", err)
+		}
+		if entry.Digest != digest {
+			t.Errorf("Expected manifest digest %q, got %q", digest, entry.Digest)
+		}
+		if entry.Size != int64(len(testData)) {
+			t.Errorf("Expected manifest size %d, got %d", len(testData), entry.Size)
+		}
 	})
+
+	t.Run("WriteFile dedupes identical content", func(t *testing.T) {
+		artA, _ := store.CreateNew()
+		artB, _ := store.CreateNew()
+
+		digestA, err := artA.WriteFile("a.txt", []byte("same bytes"))
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		digestB, err := artB.WriteFile("b.txt", []byte("same bytes"))
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		if digestA != digestB {
+			t.Errorf("Expected identical content to dedupe to the same digest, got %q and %q", digestA, digestB)
+		}
+
+		pathA, _ := store.GetArtifactPath(artA.ID, "a.txt")
+		pathB, _ := store.GetArtifactPath(artB.ID, "b.txt")
+		if pathA != pathB {
+			t.Errorf("Expected deduped content to share a blob path, got %q and %q", pathA, pathB)
+		}
+	})
+
+	t.Run("OpenForRead", func(t *testing.T) {
+		art, _ := store.CreateNew()
+		if _, err := art.WriteFile("report.md", []byte("hello readable world")); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		rs, info, err := store.OpenForRead(art.ID, "report.md")
+		if err != nil {
+			t.Fatalf("Failed to open artifact for read: %v", err)
+		}
+		defer rs.(*os.File).Close()
+
+		if info.Size() != int64(len("hello readable world")) {
+			t.Errorf("Expected size %d, got %d", len("hello readable world"), info.Size())
+		}
+		if _, err := rs.Seek(6, 0); err != nil {
+			t.Fatalf("Failed to seek: %v", err)
+		}
+		rest := make([]byte, 8)
+		if _, err := rs.Read(rest); err != nil {
+			t.Fatalf("Failed to read after seek: %v", err)
+		}
+		if string(rest) != "readable" {
+			t.Errorf("Expected 'readable' after seeking past 'hello ', got %q", string(rest))
+		}
+	})
+}
+
+func TestJobStatus(t *testing.T) {
+	basePath := t.TempDir()
+	store, err := NewStore(basePath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	art, _ := store.CreateNew()
+	if err := art.SaveStatus(JobStatus{State: "running", Sections: map[string]int{"summary_md": 0}}); err != nil {
+		t.Fatalf("Failed to save status: %v", err)
+	}
+
+	status, err := store.Status(art.ID)
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	if status.State != "running" {
+		t.Errorf("Expected state 'running', got %q", status.State)
+	}
+	if status.Sections["summary_md"] != 0 {
+		t.Errorf("Expected section progress 0, got %d", status.Sections["summary_md"])
+	}
+
+	if err := art.SaveStatus(JobStatus{State: "complete", Sections: map[string]int{"summary_md": 100}}); err != nil {
+		t.Fatalf("Failed to save status: %v", err)
+	}
+	status, err = store.Status(art.ID)
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	if status.State != "complete" || status.Sections["summary_md"] != 100 {
+		t.Errorf("Expected completed status with 100%% progress, got %+v", status)
+	}
 }
 
 func TestJanitor(t *testing.T) {
@@ -76,3 +182,44 @@ func TestJanitor(t *testing.T) {
 		t.Errorf("Expected new artifact directory to exist, but it was deleted from %s", newArt.Path)
 	}
 }
+
+func TestJanitorGarbageCollectsUnreferencedBlobs(t *testing.T) {
+	basePath := t.TempDir()
+	store, err := NewStore(basePath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.ttl = 10 * time.Millisecond
+
+	oldArt, _ := store.CreateNew()
+	if _, err := oldArt.WriteFile("orphaned.txt", []byte("will be garbage collected")); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	newArt, _ := store.CreateNew()
+	keptDigest, err := newArt.WriteFile("kept.txt", []byte("still referenced"))
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	ancientTime := time.Now().Add(-1 * time.Hour)
+	if err := os.Chtimes(oldArt.Path, ancientTime, ancientTime); err != nil {
+		t.Fatalf("Failed to change mod time: %v", err)
+	}
+
+	store.cleanup()
+
+	keptBlobPath := store.blobPath(keptDigest)
+	if _, err := os.Stat(keptBlobPath); os.IsNotExist(err) {
+		t.Errorf("Expected still-referenced blob to survive GC at %s", keptBlobPath)
+	}
+
+	blobDir := filepath.Join(basePath, blobsDirName, blobsAlgoDir)
+	files, err := os.ReadDir(blobDir)
+	if err != nil {
+		t.Fatalf("Failed to read blobs directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only the referenced blob to remain, found %d blobs", len(files))
+	}
+}
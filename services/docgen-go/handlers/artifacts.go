@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"services/docgen-go/artifact"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ArtifactsHandler serves GET /v1/docgen/artifacts/{id}/{filename},
+// honoring a standard "Range: bytes=start-end" header so large bundles
+// can be fetched in resumable chunks instead of one shot - the
+// complement to export's chunked PATCH upload, but for download.
+type ArtifactsHandler struct {
+	store *artifact.Store
+}
+
+func NewArtifactsHandler(store *artifact.Store) *ArtifactsHandler {
+	return &ArtifactsHandler{store: store}
+}
+
+func (h *ArtifactsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	filename := chi.URLParam(r, "filename")
+
+	f, info, err := h.store.OpenForRead(id, filename)
+	if err != nil {
+		slog.Warn("artifact not found", "id", id, "filename", filename, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+	if closer, ok := f.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if entry, err := h.store.GetManifestEntry(id, filename); err == nil {
+		w.Header().Set("ETag", strconv.Quote(fmt.Sprintf("sha256:%s", entry.Digest)))
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		io.Copy(w, f)
+		return
+	}
+
+	start, end, err := parseByteRange(rangeHeader, info.Size())
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size()))
+		http.Error(w, "Invalid Range header", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		slog.Error("failed to seek artifact file", "error", err, "id", id, "filename", filename)
+		http.Error(w, "Failed to read artifact", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size()))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	io.CopyN(w, f, end-start+1)
+}
+
+// parseByteRange parses a single-range "bytes=start-end" header (open
+// start for a suffix range, open end for "to EOF"), per RFC 7233.
+func parseByteRange(header string, size int64) (start, end int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, fmt.Errorf("unsupported Range unit: %q", header)
+	}
+
+	spec := strings.TrimPrefix(header, prefix)
+	if strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("multiple ranges not supported: %q", header)
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed Range header: %q", header)
+	}
+
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("malformed Range suffix: %w", err)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed Range start: %w", err)
+	}
+
+	if parts[1] == "" {
+		end = size - 1
+	} else {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("malformed Range end: %w", err)
+		}
+	}
+
+	if start > end || end >= size || start < 0 {
+		return 0, 0, fmt.Errorf("range out of bounds: %d-%d/%d", start, end, size)
+	}
+	return start, end, nil
+}
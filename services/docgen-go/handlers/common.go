@@ -3,12 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math/rand"
 	"net/http"
+	"services/docgen-go/internal/httpclient"
+	"services/docgen-go/llm"
 	"services/docgen-go/openrouter"
 	"services/docgen-go/prompts"
+	"strings"
 	"time"
 )
 
@@ -20,26 +23,90 @@ type DocGenRequest struct {
 	Model       string   `json:"model,omitempty"`
 }
 
-var defaultModels = []string{
-	"openai/gpt-oss-20b:free",
-	"google/gemini-flash-1.5",
-	"moonshotai/kimi-k2:free",
-	"google/gemma-3n-e2b-it:free",
+// ModelPolicy is an ordered list of models to try in turn. CallOpenRouter
+// moves to the next model on a transient failure (429 or 5xx), on a
+// completion with no choices, or when a malformed-JSON response could
+// not be repaired; any other request error ends the walk immediately,
+// since a 401/403/malformed-request error would just fail identically
+// against every model in the list.
+type ModelPolicy struct {
+	Models []string
 }
 
-func selectDefaultModel() string {
-	rand.Seed(time.Now().UnixNano())
-	return defaultModels[rand.Intn(len(defaultModels))]
+var defaultModelPolicy = ModelPolicy{
+	Models: []string{
+		"openai/gpt-oss-20b:free",
+		"google/gemini-flash-1.5",
+		"moonshotai/kimi-k2:free",
+		"google/gemma-3n-e2b-it:free",
+	},
 }
 
-// CallOpenRouter is a helper function to call the OpenRouter API.
-func CallOpenRouter(ctx context.Context, w http.ResponseWriter, orClient *openrouter.Client, promptName string, req *DocGenRequest) (json.RawMessage, error) {
+// modelFallbackBaseBackoff is the delay before the second model in the
+// chain; it doubles on each subsequent fallback.
+const modelFallbackBaseBackoff = 500 * time.Millisecond
+
+// AttemptOutcome records the result of a single model attempt against
+// OpenRouter - including a JSON-repair round-trip, which gets its own
+// entry - so a caller can see exactly what the fallback chain did.
+type AttemptOutcome struct {
+	Model      string `json:"model"`
+	HTTPStatus int    `json:"http_status"`
+	ParseOK    bool   `json:"parse_ok"`
+	LatencyMs  int64  `json:"latency_ms"`
+}
+
+// isTransientError reports whether err is worth retrying against the
+// next model in a ModelPolicy rather than giving up immediately.
+func isTransientError(err error) bool {
+	return errors.Is(err, openrouter.ErrRateLimited) || errors.Is(err, openrouter.ErrServerError)
+}
+
+// statusCodeOf recovers the HTTP status an OpenRouter error represents,
+// for attempt logging. It returns 0 for an error with no associated
+// status (e.g. a network failure before any response was received).
+// Errors from an llm.Provider are checked too, since llm.Router wraps the
+// same openrouter sentinels under vendor-neutral ones.
+func statusCodeOf(err error) int {
+	switch {
+	case errors.Is(err, openrouter.ErrRateLimited), errors.Is(err, llm.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, openrouter.ErrServerError):
+		return http.StatusInternalServerError
+	case errors.Is(err, openrouter.ErrUnauthorized), errors.Is(err, llm.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, openrouter.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return 0
+	}
+}
+
+// isTransientLLMError is isTransientError's llm.Provider counterpart: it
+// reports whether err is worth retrying against the next model rather
+// than giving up immediately, for calls made through an llm.Provider
+// (which wraps the same openrouter failures behind vendor-neutral
+// sentinels, or surfaces httpclient's circuit breaker directly) rather
+// than a raw *openrouter.Client.
+func isTransientLLMError(err error) bool {
+	return errors.Is(err, llm.ErrRateLimited) ||
+		errors.Is(err, openrouter.ErrServerError) ||
+		errors.Is(err, httpclient.ErrCircuitOpen)
+}
+
+// CallOpenRouter is a helper function to call the OpenRouter API. It
+// walks defaultModelPolicy (or just req.Model, if the caller pinned one)
+// on a transient failure, repairs one malformed-JSON response per model
+// with a follow-up "return only valid JSON" turn, and returns the
+// completion content alongside its token/cost usage so callers can
+// aggregate a per-prompt Usage map instead of discarding it.
+func CallOpenRouter(ctx context.Context, w http.ResponseWriter, orClient *openrouter.Client, promptName string, req *DocGenRequest) (json.RawMessage, openrouter.Usage, error) {
 	// 1. Get the prompt template
 	p, err := prompts.GetPrompt(promptName)
 	if err != nil {
 		slog.Error("failed to get prompt", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return nil, err
+		return nil, openrouter.Usage{}, err
 	}
 
 	// 2. Construct the full prompt content
@@ -48,33 +115,299 @@ func CallOpenRouter(ctx context.Context, w http.ResponseWriter, orClient *openro
 Problem Title: ` + req.Title + `
 Problem Description: ` + req.Description
 
-	// 3. Call OpenRouter
-	model := selectDefaultModel()
+	messages := []openrouter.Message{
+		{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
+		{Role: "user", Content: fullPrompt},
+	}
+
+	// 3. Call OpenRouter, walking the fallback chain and repairing
+	// malformed JSON as needed.
+	content, usage, attempts, err := callWithFallback(ctx, orClient, messages, req.Model, p.Outputs)
+
+	if len(attempts) > 0 {
+		if data, marshalErr := json.Marshal(attempts); marshalErr == nil {
+			w.Header().Set("X-DocGen-Attempts", string(data))
+		}
+	}
+	slog.Info("openrouter call attempts", "prompt", promptName, "attempts", attempts)
+
+	if err != nil {
+		slog.Error("failed to create chat completion", "error", err, "prompt", promptName)
+		http.Error(w, "Failed to generate document", http.StatusInternalServerError)
+		return nil, openrouter.Usage{}, err
+	}
+
+	return content, usage, nil
+}
+
+// callWithFallback walks models (defaultModelPolicy.Models, or just
+// pinnedModel if the caller asked for one) until a completion produces
+// valid JSON, backing off with exponential delay between models. A
+// completion whose content isn't valid JSON gets one repair round-trip
+// on the same model before moving on to the next one.
+func callWithFallback(ctx context.Context, orClient *openrouter.Client, messages []openrouter.Message, pinnedModel string, expectedOutputs []string) (json.RawMessage, openrouter.Usage, []AttemptOutcome, error) {
+	models := defaultModelPolicy.Models
+	if pinnedModel != "" {
+		models = []string{pinnedModel}
+	}
+
+	var attempts []AttemptOutcome
+	var lastErr error
+	backoff := modelFallbackBaseBackoff
+
+	for i, model := range models {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		start := time.Now()
+		orResp, err := orClient.CreateChatCompletion(ctx, openrouter.ChatRequest{
+			Model:          model,
+			Messages:       messages,
+			ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
+		})
+		latency := time.Since(start).Milliseconds()
+
+		if err != nil {
+			attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: statusCodeOf(err), LatencyMs: latency})
+			lastErr = err
+			slog.Warn("openrouter attempt failed", "model", model, "error", err, "latency_ms", latency)
+			if !isTransientError(err) {
+				break
+			}
+			continue
+		}
+
+		if len(orResp.Choices) == 0 {
+			attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, LatencyMs: latency})
+			lastErr = fmt.Errorf("no choices returned from OpenRouter")
+			slog.Warn("openrouter attempt returned no choices", "model", model, "latency_ms", latency)
+			continue
+		}
+
+		content := orResp.Choices[0].Message.Content
+		if json.Valid([]byte(content)) {
+			attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, ParseOK: true, LatencyMs: latency})
+			return json.RawMessage(content), orResp.Usage, attempts, nil
+		}
+
+		attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, ParseOK: false, LatencyMs: latency})
+		slog.Warn("openrouter response was not valid JSON, attempting repair", "model", model, "latency_ms", latency)
+
+		repaired, repairUsage, repairLatency, repairErr := repairJSON(ctx, orClient, model, content, expectedOutputs)
+		if repairErr != nil {
+			lastErr = repairErr
+			attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: statusCodeOf(repairErr), LatencyMs: repairLatency})
+			slog.Warn("json repair failed", "model", model, "error", repairErr, "latency_ms", repairLatency)
+			continue
+		}
+
+		attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, ParseOK: true, LatencyMs: repairLatency})
+		return repaired, mergeUsage(orResp.Usage, repairUsage), attempts, nil
+	}
+
+	return nil, openrouter.Usage{}, attempts, lastErr
+}
+
+// repairJSON re-sends a malformed completion to the same model with an
+// instruction to return clean JSON, so a single truncated or
+// commentary-wrapped response doesn't need a whole new completion from
+// scratch.
+func repairJSON(ctx context.Context, orClient *openrouter.Client, model, malformed string, expectedOutputs []string) (json.RawMessage, openrouter.Usage, int64, error) {
+	start := time.Now()
+	orResp, err := orClient.CreateChatCompletion(ctx, openrouter.ChatRequest{
+		Model: model,
+		Messages: []openrouter.Message{
+			{Role: "system", Content: fmt.Sprintf("Return ONLY valid JSON conforming to keys: %s", strings.Join(expectedOutputs, ", "))},
+			{Role: "user", Content: malformed},
+		},
+		ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
+	})
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return nil, openrouter.Usage{}, latency, fmt.Errorf("json repair request: %w", err)
+	}
+	if len(orResp.Choices) == 0 {
+		return nil, openrouter.Usage{}, latency, fmt.Errorf("json repair returned no choices")
+	}
+
+	content := orResp.Choices[0].Message.Content
+	if !json.Valid([]byte(content)) {
+		return nil, openrouter.Usage{}, latency, fmt.Errorf("json repair still produced invalid JSON")
+	}
+	return json.RawMessage(content), orResp.Usage, latency, nil
+}
+
+// callProviderWithFallback is callWithFallback's llm.Provider counterpart,
+// used by PlanHandler, DesignHandler, and FullHandler so /plan, /design,
+// /full, and /jobs (which all drive generation through an llm.Provider
+// rather than a raw *openrouter.Client) get the same model-fallback and
+// JSON-repair behavior as /summary instead of failing outright on the
+// first bad completion. req.Model pins a single model, the same as
+// CallOpenRouter; an empty req.Model walks defaultModelPolicy.
+// expectedOutputs is only consulted when req.JSONMode is set.
+func callProviderWithFallback(ctx context.Context, provider llm.Provider, req llm.Request, expectedOutputs []string) (llm.Response, []AttemptOutcome, error) {
+	models := defaultModelPolicy.Models
+	if req.Model != "" {
+		models = []string{req.Model}
+	}
+
+	var attempts []AttemptOutcome
+	var lastErr error
+	backoff := modelFallbackBaseBackoff
+
+	for i, model := range models {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		attempt := req
+		attempt.Model = model
+
+		start := time.Now()
+		resp, err := provider.Chat(ctx, attempt)
+		latency := time.Since(start).Milliseconds()
+
+		if err != nil {
+			var invalidJSON *llm.InvalidJSONError
+			if req.JSONMode && errors.As(err, &invalidJSON) {
+				attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, LatencyMs: latency})
+				slog.Warn("llm response was not valid JSON, attempting repair", "model", model, "latency_ms", latency)
+
+				repaired, repairLatency, repairErr := repairProviderJSON(ctx, provider, model, invalidJSON.Content, expectedOutputs)
+				if repairErr != nil {
+					lastErr = repairErr
+					attempts = append(attempts, AttemptOutcome{Model: model, LatencyMs: repairLatency})
+					slog.Warn("llm json repair failed", "model", model, "error", repairErr, "latency_ms", repairLatency)
+					continue
+				}
+
+				attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, ParseOK: true, LatencyMs: repairLatency})
+				return repaired, attempts, nil
+			}
+
+			attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: statusCodeOf(err), LatencyMs: latency})
+			lastErr = err
+			slog.Warn("llm provider attempt failed", "model", model, "error", err, "latency_ms", latency)
+			if !isTransientLLMError(err) {
+				break
+			}
+			continue
+		}
+
+		attempts = append(attempts, AttemptOutcome{Model: model, HTTPStatus: http.StatusOK, ParseOK: true, LatencyMs: latency})
+		return resp, attempts, nil
+	}
+
+	return llm.Response{}, attempts, lastErr
+}
+
+// repairProviderJSON is repairJSON's llm.Provider counterpart: it
+// re-sends a malformed completion to the same model with an instruction
+// to return clean JSON, so a single truncated or commentary-wrapped
+// response doesn't need a whole new completion from scratch. The
+// provider itself re-validates the repaired content and returns
+// llm.ErrInvalidJSON again if it's still malformed, so there's nothing
+// left to check here.
+func repairProviderJSON(ctx context.Context, provider llm.Provider, model, malformed string, expectedOutputs []string) (llm.Response, int64, error) {
+	start := time.Now()
+	resp, err := provider.Chat(ctx, llm.Request{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: "system", Content: fmt.Sprintf("Return ONLY valid JSON conforming to keys: %s", strings.Join(expectedOutputs, ", "))},
+			{Role: "user", Content: malformed},
+		},
+		JSONMode: true,
+	})
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return llm.Response{}, latency, fmt.Errorf("llm json repair request: %w", err)
+	}
+	return resp, latency, nil
+}
+
+func mergeUsage(a, b openrouter.Usage) openrouter.Usage {
+	return openrouter.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+		Cost:             a.Cost + b.Cost,
+	}
+}
+
+// StreamOpenRouter is the streaming counterpart of CallOpenRouter: it
+// writes each generated token as a "token" SSE event and a final "done"
+// event carrying the fully-assembled content, so clients can render the
+// document progressively instead of waiting on the whole completion.
+// provider is an llm.Provider rather than a concrete *openrouter.Client
+// so callers routed through an llm.Router still get progressive output.
+func StreamOpenRouter(ctx context.Context, w http.ResponseWriter, provider llm.Provider, promptName string, req *DocGenRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	p, err := prompts.GetPrompt(promptName)
+	if err != nil {
+		slog.Error("failed to get prompt", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fullPrompt := p.Template + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
+
+	// Streaming can't transparently fall back mid-response the way
+	// CallOpenRouter does, so it just takes the first model in the
+	// policy rather than walking the whole chain.
+	model := defaultModelPolicy.Models[0]
 	if req.Model != "" {
 		model = req.Model
 	}
 
-	orReq := openrouter.ChatRequest{
+	llmReq := llm.Request{
 		Model: model,
-		Messages: []openrouter.Message{
+		Messages: []llm.Message{
 			{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
 			{Role: "user", Content: fullPrompt},
 		},
-		ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
 	}
 
-	orResp, err := orClient.CreateChatCompletion(ctx, orReq)
+	stream, err := provider.ChatStream(ctx, llmReq)
 	if err != nil {
-		slog.Error("failed to create chat completion", "error", err)
+		slog.Error("failed to start chat completion stream", "error", err)
 		http.Error(w, "Failed to generate document", http.StatusInternalServerError)
-		return nil, err
+		return
 	}
 
-	if len(orResp.Choices) == 0 {
-		slog.Error("no choices returned from OpenRouter")
-		http.Error(w, "Failed to generate document", http.StatusInternalServerError)
-		return nil, fmt.Errorf("no choices returned from OpenRouter")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var full strings.Builder
+	for ev := range stream.Events() {
+		if ev.Err != nil {
+			slog.Error("stream error", "error", ev.Err)
+			writeSSE(w, flusher, "error", map[string]string{"error": ev.Err.Error()})
+			return
+		}
+		full.WriteString(ev.Delta)
+		writeSSE(w, flusher, "token", map[string]string{"delta": ev.Delta})
 	}
 
-	return []byte(orResp.Choices[0].Message.Content), nil
+	writeSSE(w, flusher, "done", map[string]string{"content": full.String()})
+}
+
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, event string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("failed to marshal SSE payload", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	flusher.Flush()
 }
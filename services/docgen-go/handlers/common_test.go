@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"services/docgen-go/internal/httpclient"
+	"services/docgen-go/llm"
+	"services/docgen-go/openrouter"
+	"testing"
+)
+
+func TestIsTransientError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"rate limited", openrouter.ErrRateLimited, true},
+		{"server error", openrouter.ErrServerError, true},
+		{"wrapped server error", errors.New("wrapping: " + openrouter.ErrServerError.Error()), false}, // not errors.Is-compatible without %w
+		{"unauthorized", openrouter.ErrUnauthorized, false},
+		{"forbidden", openrouter.ErrForbidden, false},
+		{"generic error", errors.New("boom"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransientError(tc.err); got != tc.transient {
+				t.Errorf("isTransientError(%v) = %v, want %v", tc.err, got, tc.transient)
+			}
+		})
+	}
+}
+
+func TestIsTransientLLMError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"llm rate limited", llm.ErrRateLimited, true},
+		{"openrouter server error passthrough", openrouter.ErrServerError, true},
+		{"circuit open", httpclient.ErrCircuitOpen, true},
+		{"llm unauthorized", llm.ErrUnauthorized, false},
+		{"invalid json is not transient by itself", llm.ErrInvalidJSON, false},
+		{"generic error", errors.New("boom"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransientLLMError(tc.err); got != tc.transient {
+				t.Errorf("isTransientLLMError(%v) = %v, want %v", tc.err, got, tc.transient)
+			}
+		})
+	}
+}
+
+func TestStatusCodeOf(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"openrouter rate limited", openrouter.ErrRateLimited, http.StatusTooManyRequests},
+		{"llm rate limited", llm.ErrRateLimited, http.StatusTooManyRequests},
+		{"openrouter server error", openrouter.ErrServerError, http.StatusInternalServerError},
+		{"openrouter unauthorized", openrouter.ErrUnauthorized, http.StatusUnauthorized},
+		{"llm unauthorized", llm.ErrUnauthorized, http.StatusUnauthorized},
+		{"openrouter forbidden", openrouter.ErrForbidden, http.StatusForbidden},
+		{"unclassified error", errors.New("boom"), 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := statusCodeOf(tc.err); got != tc.want {
+				t.Errorf("statusCodeOf(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInvalidJSONErrorCarriesContentAndUnwraps(t *testing.T) {
+	err := &llm.InvalidJSONError{Content: `{"broken": `}
+
+	if !errors.Is(err, llm.ErrInvalidJSON) {
+		t.Error("expected errors.Is to match llm.ErrInvalidJSON through Unwrap")
+	}
+
+	var asInvalid *llm.InvalidJSONError
+	if !errors.As(err, &asInvalid) {
+		t.Fatal("expected errors.As to recover the InvalidJSONError")
+	}
+	if asInvalid.Content != `{"broken": ` {
+		t.Errorf("expected recovered content to match, got %q", asInvalid.Content)
+	}
+}
+
+func TestMergeUsage(t *testing.T) {
+	// Cost values are exact in binary floating point (multiples of 0.25)
+	// so the comparison below isn't at the mercy of rounding.
+	a := openrouter.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: 1.5}
+	b := openrouter.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, Cost: 0.25}
+
+	got := mergeUsage(a, b)
+	want := openrouter.Usage{PromptTokens: 13, CompletionTokens: 7, TotalTokens: 20, Cost: 1.75}
+	if got != want {
+		t.Errorf("mergeUsage() = %+v, want %+v", got, want)
+	}
+}
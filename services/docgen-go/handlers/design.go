@@ -4,19 +4,10 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
-	"services/docgen-go/openrouter"
+	"services/docgen-go/llm"
 	"services/docgen-go/prompts"
 )
 
-// Diagram represents a single diagram in a design response.
-type Diagram struct {
-	ID       string `json:"id"`
-	Type     string `json:"type"`
-	Language string `json:"language"`
-	Title    string `json:"title,omitempty"`
-	Code     string `json:"code"`
-}
-
 // DesignResponse is the response for the /design endpoint.
 type DesignResponse struct {
 	DesignMD string    `json:"design_md"`
@@ -24,11 +15,11 @@ type DesignResponse struct {
 }
 
 type DesignHandler struct {
-	orClient *openrouter.Client
+	provider llm.Provider
 }
 
-func NewDesignHandler(orClient *openrouter.Client) *DesignHandler {
-	return &DesignHandler{orClient: orClient}
+func NewDesignHandler(provider llm.Provider) *DesignHandler {
+	return &DesignHandler{provider: provider}
 }
 
 func (h *DesignHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -48,37 +39,31 @@ func (h *DesignHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	fullPrompt := p.Template + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
 
-	model := "openrouter/auto"
-	if req.Model != "" {
-		model = req.Model
-	}
-
-	orReq := openrouter.ChatRequest{
-		Model: model,
-		Messages: []openrouter.Message{
+	llmReq := llm.Request{
+		Model: req.Model,
+		Messages: []llm.Message{
 			{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
 			{Role: "user", Content: fullPrompt},
 		},
-		ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
+		JSONMode: true,
 	}
 
-	orResp, err := h.orClient.CreateChatCompletion(r.Context(), orReq)
+	// callProviderWithFallback walks defaultModelPolicy (including
+	// substituting a default when req.Model is empty) on a transient
+	// failure and repairs one malformed-JSON response per model, the
+	// same as /full and /jobs, instead of failing outright on the first
+	// bad completion.
+	resp, attempts, err := callProviderWithFallback(r.Context(), h.provider, llmReq, p.Outputs)
+	slog.Info("llm call attempts", "prompt", "architecture_overview", "attempts", attempts)
 	if err != nil {
 		slog.Error("failed to create chat completion", "error", err)
 		http.Error(w, "Failed to generate design", http.StatusInternalServerError)
 		return
 	}
 
-	if len(orResp.Choices) == 0 {
-		slog.Error("no choices returned from OpenRouter")
-		http.Error(w, "Failed to generate design", http.StatusInternalServerError)
-		return
-	}
-
 	var designResp DesignResponse
-	err = json.Unmarshal([]byte(orResp.Choices[0].Message.Content), &designResp)
-	if err != nil {
-		slog.Error("failed to unmarshal LLM response", "error", err, "response", orResp.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(resp.Content), &designResp); err != nil {
+		slog.Error("failed to unmarshal LLM response", "error", err, "response", resp.Content)
 		http.Error(w, "Failed to parse LLM response", http.StatusInternalServerError)
 		return
 	}
@@ -88,3 +73,19 @@ func (h *DesignHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.Error("failed to write response", "error", err)
 	}
 }
+
+// ServeStream streams the architecture overview over Server-Sent Events
+// as it's generated, instead of blocking until the full completion
+// lands. Note that the streamed text does not include the Diagrams the
+// non-streaming /design endpoint returns, since those only exist once
+// the full JSON response has been parsed.
+func (h *DesignHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	var req DocGenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	StreamOpenRouter(r.Context(), w, h.provider, "architecture_overview", &req)
+}
@@ -1,37 +1,92 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
 	"services/docgen-go/artifact"
+	"services/docgen-go/internal/metrics"
+	"services/docgen-go/render"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/jung-kurt/gofpdf"
 )
 
-// ExportRequest is the request for the /export endpoint.
+// ExportRequest is the request for the POST /export endpoint. It only
+// carries job metadata; the actual bundle is sent afterwards via the
+// chunked upload protocol so large bundles (e.g. 50MB+ PDF-ready content)
+// don't have to fit in a single request body.
 type ExportRequest struct {
-	Bundle map[string]interface{} `json:"bundle"`
-	Format string                 `json:"format"` // "pdf" or "zip"
+	Format string `json:"format"` // "pdf" or "zip"
 }
 
-// ExportResponse is the response for the /export endpoint.
-type ExportResponse struct {
-	ArtifactID string   `json:"artifact_id"`
-	Filenames  []string `json:"filenames"`
+// StartExportResponse is returned immediately when an export job is created.
+type StartExportResponse struct {
+	JobID     string `json:"job_id"`
+	UploadURL string `json:"upload_url"`
+}
+
+// ExportStatusResponse describes the current state of an export job.
+type ExportStatusResponse struct {
+	JobID      string   `json:"job_id"`
+	Status     string   `json:"status"` // "uploading", "processing", "complete", "error"
+	Committed  int64    `json:"committed_bytes"`
+	ArtifactID string   `json:"artifact_id,omitempty"`
+	Filenames  []string `json:"filenames,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+const exportUploadFilename = "bundle.upload"
+
+// exportJobTTL bounds how long a finished (complete or error) job's
+// in-memory entry survives before the janitor reclaims it, so jobs
+// doesn't grow without bound across a long-running process.
+const exportJobTTL = 15 * time.Minute
+
+// exportJob tracks the chunked-upload and background-render lifecycle of
+// a single export.
+type exportJob struct {
+	mu        sync.Mutex
+	format    string
+	art       *artifact.Artifact
+	committed int64
+	finalized bool
+	status    string
+	filenames []string
+	err       string
+	updatedAt time.Time
 }
 
 type ExportHandler struct {
-	store *artifact.Store
+	store    *artifact.Store
+	renderer *render.Registry
+
+	mu   sync.Mutex
+	jobs map[string]*exportJob
 }
 
-func NewExportHandler(store *artifact.Store) *ExportHandler {
-	return &ExportHandler{store: store}
+func NewExportHandler(store *artifact.Store, renderer *render.Registry) *ExportHandler {
+	return &ExportHandler{
+		store:    store,
+		renderer: renderer,
+		jobs:     make(map[string]*exportJob),
+	}
 }
 
-func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// HandleStart creates a new export job and returns an upload URL the
+// client should PATCH the bundle payload to.
+func (h *ExportHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
 	var req ExportRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -39,6 +94,11 @@ func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	if req.Format != "pdf" && req.Format != "zip" {
+		http.Error(w, "format must be 'pdf' or 'zip'", http.StatusBadRequest)
+		return
+	}
+
 	art, err := h.store.CreateNew()
 	if err != nil {
 		slog.Error("failed to create artifact", "error", err)
@@ -46,63 +106,450 @@ func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	job := &exportJob{
+		format:    req.Format,
+		art:       art,
+		status:    "uploading",
+		updatedAt: time.Now(),
+	}
+
+	h.mu.Lock()
+	h.jobs[art.ID] = job
+	h.mu.Unlock()
+
+	resp := StartExportResponse{
+		JobID:     art.ID,
+		UploadURL: fmt.Sprintf("/v1/docgen/exports/%s", art.ID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+// HandleChunk accepts a single chunk of the bundle upload, identified by
+// a "Content-Range: start-end" header (distribution-style, no unit
+// prefix), and persists the committed offset so a dropped connection can
+// resume from where it left off.
+func (h *ExportHandler) HandleChunk(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	start, end, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		http.Error(w, "Invalid Content-Range header", http.StatusBadRequest)
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if job.finalized {
+		http.Error(w, "Upload already finalized", http.StatusConflict)
+		return
+	}
+	if start != job.committed {
+		w.Header().Set("Range", fmt.Sprintf("0-%d", job.committed))
+		http.Error(w, "Chunk does not start at committed offset", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	f, err := os.OpenFile(job.art.GetFilePath(exportUploadFilename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		slog.Error("failed to open upload file", "error", err)
+		http.Error(w, "Failed to persist chunk", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r.Body)
+	if err != nil {
+		slog.Error("failed to write chunk", "error", err)
+		http.Error(w, "Failed to persist chunk", http.StatusInternalServerError)
+		return
+	}
+	if n != end-start+1 {
+		slog.Warn("chunk size mismatch against Content-Range", "declared", end-start+1, "received", n)
+	}
+
+	job.committed += n
+	job.updatedAt = time.Now()
+
+	// A chunked upload can take far longer than artifact.Store's TTL to
+	// finish on a flaky connection (chunks can be minutes apart); reset
+	// the artifact directory's mtime on every chunk so the janitor
+	// doesn't evict it mid-upload, the same way SaveStatus does for jobs.
+	if err := os.Chtimes(job.art.Path, job.updatedAt, job.updatedAt); err != nil {
+		slog.Warn("failed to refresh artifact mtime after chunk", "error", err, "job_id", job.art.ID)
+	}
+
+	w.Header().Set("Range", fmt.Sprintf("0-%d", job.committed))
+	w.Header().Set("Location", fmt.Sprintf("/v1/docgen/exports/%s", job.art.ID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleFinalize closes the upload, optionally verifies an integrity
+// digest, and kicks off rendering in the background so the request
+// doesn't block on PDF generation.
+func (h *ExportHandler) HandleFinalize(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	job.mu.Lock()
+	if job.finalized {
+		job.mu.Unlock()
+		http.Error(w, "Upload already finalized", http.StatusConflict)
+		return
+	}
+	job.finalized = true
+	job.status = "processing"
+	job.updatedAt = time.Now()
+	uploadPath := job.art.GetFilePath(exportUploadFilename)
+	job.mu.Unlock()
+
+	if digest := r.Header.Get("Digest"); digest != "" {
+		if err := verifyDigest(uploadPath, digest); err != nil {
+			job.mu.Lock()
+			job.status = "error"
+			job.err = err.Error()
+			job.updatedAt = time.Now()
+			job.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	go h.render(job)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleStatus reports the current state of an export job so clients can
+// poll until rendering finishes.
+func (h *ExportHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	job.mu.Lock()
+	resp := ExportStatusResponse{
+		JobID:     job.art.ID,
+		Status:    job.status,
+		Committed: job.committed,
+		Filenames: job.filenames,
+		Error:     job.err,
+	}
+	if job.status == "complete" {
+		resp.ArtifactID = job.art.ID
+	}
+	job.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+// StartJanitor periodically reclaims jobs map entries for uploads that
+// finished (complete or error) more than exportJobTTL ago. Without this,
+// jobs accumulates forever since nothing else ever removes an entry; the
+// artifact directory itself is left to artifact.Store's own TTL-based
+// janitor, which owns that independently.
+func (h *ExportHandler) StartJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			h.cleanup()
+		}
+	}()
+}
+
+func (h *ExportHandler) cleanup() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, job := range h.jobs {
+		job.mu.Lock()
+		stale := (job.status == "complete" || job.status == "error") && time.Since(job.updatedAt) > exportJobTTL
+		job.mu.Unlock()
+		if stale {
+			delete(h.jobs, id)
+		}
+	}
+}
+
+func (h *ExportHandler) lookupJob(w http.ResponseWriter, r *http.Request) (*exportJob, bool) {
+	jobID := chi.URLParam(r, "jobID")
+
+	h.mu.Lock()
+	job, ok := h.jobs[jobID]
+	h.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return job, true
+}
+
+// render reads the finalized upload, parses it as a bundle, and writes
+// the rendered PDF or markdown files into the job's artifact directory.
+func (h *ExportHandler) render(job *exportJob) {
+	data, err := os.ReadFile(job.art.GetFilePath(exportUploadFilename))
+	if err != nil {
+		slog.Error("failed to read finalized upload", "error", err, "job_id", job.art.ID)
+		job.mu.Lock()
+		job.status = "error"
+		job.err = err.Error()
+		job.updatedAt = time.Now()
+		job.mu.Unlock()
+		return
+	}
+	metrics.ExportBundleSizeBytes.WithLabelValues(job.format).Observe(float64(len(data)))
+
+	var bundle map[string]interface{}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		slog.Error("failed to unmarshal bundle", "error", err, "job_id", job.art.ID)
+		job.mu.Lock()
+		job.status = "error"
+		job.err = err.Error()
+		job.updatedAt = time.Now()
+		job.mu.Unlock()
+		return
+	}
+
+	renderStart := time.Now()
+	filenames, err := renderBundle(context.Background(), h.renderer, job.art, job.format, bundle)
+	metrics.ExportRenderDuration.WithLabelValues(job.format).Observe(time.Since(renderStart).Seconds())
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.updatedAt = time.Now()
+	if err != nil {
+		slog.Error("failed to render bundle", "error", err, "job_id", job.art.ID)
+		job.status = "error"
+		job.err = err.Error()
+		return
+	}
+	job.filenames = filenames
+	job.status = "complete"
+}
+
+// renderBundle writes each entry in bundle to the artifact, either as one
+// simple PDF per section (plus a diagrams.pdf with the rendered PNG
+// diagrams embedded as images) or as markdown plus sibling diagram images
+// for zip bundling. The
+// "diagrams" key, if present, is extracted and rendered via registry
+// rather than treated as another markdown section.
+func renderBundle(ctx context.Context, registry *render.Registry, art *artifact.Artifact, format string, bundle map[string]interface{}) ([]string, error) {
 	var filenames []string
-	if req.Format == "pdf" {
-		for key, value := range req.Bundle {
-			if content, ok := value.(string); ok {
-				filename := fmt.Sprintf("%s.pdf", key)
-				pdf := gofpdf.New("P", "mm", "A4", "")
-				pdf.SetMargins(15, 15, 15)
-				pdf.SetAutoPageBreak(true, 15)
-				pdf.AddPage()
-				// Use a built-in core font to avoid missing font errors in minimal containers
-				pdf.SetFont("Helvetica", "", 12)
-
-				lines := strings.Split(content, "\n")
-				for _, line := range lines {
-					if strings.HasPrefix(line, "# ") {
-						pdf.SetFont("Helvetica", "B", 16)
-						pdf.Cell(40, 10, strings.TrimPrefix(line, "# "))
-						pdf.Ln(12)
-						pdf.SetFont("Helvetica", "", 12)
-					} else {
-						pdf.MultiCell(0, 10, line, "", "", false)
-						pdf.Ln(4)
-					}
+
+	diagrams, err := extractDiagrams(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("extract diagrams: %w", err)
+	}
+
+	var rendered []renderedDiagram
+	if registry != nil {
+		for _, d := range diagrams {
+			data, mime, err := registry.Render(ctx, d)
+			if err != nil {
+				slog.Warn("failed to render diagram, skipping", "error", err, "diagram_id", d.ID)
+				continue
+			}
+			rendered = append(rendered, renderedDiagram{diagram: d, data: data, mime: mime})
+		}
+	}
+
+	if format == "pdf" {
+		for key, value := range bundle {
+			content, ok := value.(string)
+			if !ok {
+				continue
+			}
+			filename := fmt.Sprintf("%s.pdf", key)
+			pdf := gofpdf.New("P", "mm", "A4", "")
+			pdf.SetMargins(15, 15, 15)
+			pdf.SetAutoPageBreak(true, 15)
+			pdf.AddPage()
+			// Use a built-in core font to avoid missing font errors in minimal containers
+			pdf.SetFont("Helvetica", "", 12)
+
+			lines := strings.Split(content, "\n")
+			for _, line := range lines {
+				if strings.HasPrefix(line, "# ") {
+					pdf.SetFont("Helvetica", "B", 16)
+					pdf.Cell(40, 10, strings.TrimPrefix(line, "# "))
+					pdf.Ln(12)
+					pdf.SetFont("Helvetica", "", 12)
+				} else {
+					pdf.MultiCell(0, 10, line, "", "", false)
+					pdf.Ln(4)
 				}
+			}
 
-				// Write PDF directly to the artifact path; the file doesn't exist yet, so don't check for it
-				path := art.GetFilePath(filename)
-				if err := pdf.OutputFileAndClose(path); err != nil {
-					slog.Error("failed to write pdf file", "error", err)
-					http.Error(w, "Failed to write pdf file", http.StatusInternalServerError)
-					return
+			var buf bytes.Buffer
+			if err := pdf.Output(&buf); err != nil {
+				return nil, fmt.Errorf("failed to render pdf file %s: %w", filename, err)
+			}
+			if _, err := art.WriteFile(filename, buf.Bytes()); err != nil {
+				return nil, fmt.Errorf("failed to write pdf file %s: %w", filename, err)
+			}
+			filenames = append(filenames, filename)
+		}
+
+		if len(rendered) > 0 {
+			diagramFilename := "diagrams.pdf"
+			pdf := gofpdf.New("P", "mm", "A4", "")
+			pdf.SetMargins(15, 15, 15)
+			pdf.SetAutoPageBreak(true, 15)
+			for _, rd := range rendered {
+				if rd.mime != "image/png" {
+					// Non-raster fallbacks (e.g. the fenced-code-block fallback) aren't
+					// embeddable as a PDF image; skip rather than corrupt the page.
+					continue
 				}
-				filenames = append(filenames, filename)
+				pdf.AddPage()
+				pdf.SetFont("Helvetica", "B", 14)
+				pdf.Cell(40, 10, rd.diagram.Title)
+				pdf.Ln(14)
+				opts := gofpdf.ImageOptions{ImageType: "PNG"}
+				pdf.RegisterImageOptionsReader(rd.diagram.ID, opts, bytes.NewReader(rd.data))
+				pdf.ImageOptions(rd.diagram.ID, 15, pdf.GetY(), 180, 0, false, opts, 0, "")
+			}
+			var buf bytes.Buffer
+			if err := pdf.Output(&buf); err != nil {
+				return nil, fmt.Errorf("failed to render diagrams pdf: %w", err)
 			}
+			if _, err := art.WriteFile(diagramFilename, buf.Bytes()); err != nil {
+				return nil, fmt.Errorf("failed to write diagrams pdf: %w", err)
+			}
+			filenames = append(filenames, diagramFilename)
 		}
 	} else {
-		// For now, we just write the markdown content from the bundle.
-		for key, value := range req.Bundle {
-			if content, ok := value.(string); ok {
-				filename := fmt.Sprintf("%s.md", key)
-				if _, err := art.WriteFile(filename, []byte(content)); err != nil {
-					slog.Error("failed to write artifact file", "error", err, "filename", filename)
-					http.Error(w, "Failed to write artifact file", http.StatusInternalServerError)
-					return
-				}
-				filenames = append(filenames, filename)
+		for key, value := range bundle {
+			content, ok := value.(string)
+			if !ok {
+				continue
+			}
+			filename := fmt.Sprintf("%s.md", key)
+			if _, err := art.WriteFile(filename, []byte(content)); err != nil {
+				return nil, fmt.Errorf("failed to write artifact file %s: %w", filename, err)
+			}
+			filenames = append(filenames, filename)
+		}
+
+		for _, rd := range rendered {
+			ext := extensionForMime(rd.mime)
+			filename := fmt.Sprintf("%s.%s", rd.diagram.ID, ext)
+			if _, err := art.WriteFile(filename, rd.data); err != nil {
+				return nil, fmt.Errorf("failed to write diagram file %s: %w", filename, err)
 			}
+			filenames = append(filenames, filename)
 		}
 	}
 
-	resp := ExportResponse{
-		ArtifactID: art.ID,
-		Filenames:  filenames,
+	return filenames, nil
+}
+
+type renderedDiagram struct {
+	diagram render.Diagram
+	data    []byte
+	mime    string
+}
+
+// extractDiagrams pulls the "diagrams" key out of bundle (if present) and
+// decodes it into render.Diagram values, removing it from bundle so it
+// isn't also treated as a markdown section.
+func extractDiagrams(bundle map[string]interface{}) ([]render.Diagram, error) {
+	raw, ok := bundle["diagrams"]
+	if !ok {
+		return nil, nil
 	}
+	delete(bundle, "diagrams")
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		slog.Error("failed to write response", "error", err)
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var diagrams []Diagram
+	if err := json.Unmarshal(encoded, &diagrams); err != nil {
+		return nil, err
+	}
+
+	out := make([]render.Diagram, 0, len(diagrams))
+	for _, d := range diagrams {
+		out = append(out, render.Diagram{
+			ID:       d.ID,
+			Type:     d.Type,
+			Language: d.Language,
+			Title:    d.Title,
+			Code:     d.Code,
+		})
+	}
+	return out, nil
+}
+
+func extensionForMime(mime string) string {
+	switch mime {
+	case "image/png":
+		return "png"
+	case "image/svg+xml":
+		return "svg"
+	default:
+		return "md"
+	}
+}
+
+// parseContentRange parses a distribution-style "start-end" range header
+// (no "bytes=" unit prefix, no total length).
+func parseContentRange(header string) (start, end int64, err error) {
+	parts := strings.SplitN(header, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed Content-Range header: %q", header)
+	}
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed Content-Range start: %w", err)
+	}
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed Content-Range end: %w", err)
+	}
+	return start, end, nil
+}
+
+// verifyDigest checks that the file at path hashes to the sha256 digest
+// given as "sha256:<hex>".
+func verifyDigest(path, digest string) error {
+	const prefix = "sha256:"
+	if !strings.HasPrefix(digest, prefix) {
+		return fmt.Errorf("unsupported digest algorithm: %q", digest)
+	}
+	want := strings.TrimPrefix(digest, prefix)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open upload for digest verification: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to hash upload: %w", err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+
+	if got != want {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", want, got)
 	}
+	return nil
 }
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	t.Run("valid range", func(t *testing.T) {
+		start, end, err := parseContentRange("0-1023")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if start != 0 || end != 1023 {
+			t.Errorf("Expected start=0 end=1023, got start=%d end=%d", start, end)
+		}
+	})
+
+	t.Run("subsequent chunk", func(t *testing.T) {
+		start, end, err := parseContentRange("1024-2047")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if start != 1024 || end != 2047 {
+			t.Errorf("Expected start=1024 end=2047, got start=%d end=%d", start, end)
+		}
+	})
+
+	t.Run("missing separator", func(t *testing.T) {
+		if _, _, err := parseContentRange("1024"); err == nil {
+			t.Error("Expected an error for a header with no '-' separator")
+		}
+	})
+
+	t.Run("non-numeric start", func(t *testing.T) {
+		if _, _, err := parseContentRange("abc-2047"); err == nil {
+			t.Error("Expected an error for a non-numeric start")
+		}
+	})
+
+	t.Run("non-numeric end", func(t *testing.T) {
+		if _, _, err := parseContentRange("0-abc"); err == nil {
+			t.Error("Expected an error for a non-numeric end")
+		}
+	})
+
+	t.Run("rejects bytes= prefix", func(t *testing.T) {
+		// This is the distribution-style header, not RFC 7233's
+		// "Range: bytes=start-end" - a "bytes=" prefix should fail to
+		// parse as an integer rather than silently being accepted.
+		if _, _, err := parseContentRange("bytes=0-1023"); err == nil {
+			t.Error("Expected an error for a 'bytes=' prefixed header")
+		}
+	})
+}
+
+func TestVerifyDigest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "upload.bin")
+	content := []byte("hello digest world")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	sum := sha256.Sum256(content)
+	validDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	t.Run("matching digest", func(t *testing.T) {
+		if err := verifyDigest(path, validDigest); err != nil {
+			t.Errorf("Expected no error for a matching digest, got %v", err)
+		}
+	})
+
+	t.Run("mismatched digest", func(t *testing.T) {
+		err := verifyDigest(path, "sha256:"+hex.EncodeToString(make([]byte, sha256.Size)))
+		if err == nil {
+			t.Error("Expected an error for a mismatched digest")
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		err := verifyDigest(path, "md5:deadbeef")
+		if err == nil {
+			t.Error("Expected an error for an unsupported digest algorithm")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := verifyDigest(filepath.Join(dir, "does-not-exist.bin"), validDigest)
+		if err == nil {
+			t.Error("Expected an error when the upload file doesn't exist")
+		}
+	})
+}
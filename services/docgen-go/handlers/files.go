@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"services/docgen-go/artifact"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -31,3 +34,43 @@ func (h *FilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// http.ServeFile handles Content-Type and other headers automatically
 	http.ServeFile(w, r, path)
 }
+
+// ServeManifest serves GET /v1/docgen/files/{id}/manifest.json, letting
+// clients see every filename/digest/size in a bundle without fetching
+// each file.
+func (h *FilesHandler) ServeManifest(w http.ResponseWriter, r *http.Request) {
+	artifactID := chi.URLParam(r, "id")
+
+	manifest, err := h.store.GetManifest(artifactID)
+	if err != nil {
+		slog.Warn("manifest not found", "id", artifactID, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+// ServeHead serves HEAD /v1/docgen/files/{id}/{filename}, returning
+// integrity and caching headers without the file body so clients can
+// verify or conditionally re-fetch a previously downloaded artifact.
+func (h *FilesHandler) ServeHead(w http.ResponseWriter, r *http.Request) {
+	artifactID := chi.URLParam(r, "id")
+	filename := chi.URLParam(r, "filename")
+
+	entry, err := h.store.GetManifestEntry(artifactID, filename)
+	if err != nil {
+		slog.Warn("artifact not found", "id", artifactID, "filename", filename, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	digest := fmt.Sprintf("sha256:%s", entry.Digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", strconv.Quote(digest))
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
@@ -6,16 +6,34 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"services/docgen-go/openrouter"
+	"services/docgen-go/llm"
 	"services/docgen-go/prompts"
 	"strings"
 	"sync"
+	"time"
 )
 
+// defaultPerPromptTimeout bounds how long any single prompt goroutine in
+// generateCombined is allowed to run before it's treated as failed, so a
+// slow model call can't stall the whole document behind it.
+const defaultPerPromptTimeout = 45 * time.Second
+
 // FullRequest is the request for the /full endpoint.
 type FullRequest struct {
 	DocGenRequest
 	Prompts []string `json:"prompts"`
+	// PerPromptTimeoutSeconds overrides defaultPerPromptTimeout; zero
+	// (the common case) means "use the default".
+	PerPromptTimeoutSeconds int `json:"per_prompt_timeout_seconds,omitempty"`
+}
+
+// perPromptTimeout resolves a request's PerPromptTimeoutSeconds override,
+// falling back to defaultPerPromptTimeout when unset.
+func perPromptTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultPerPromptTimeout
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // FullResponse is the response for the /full endpoint.
@@ -32,16 +50,57 @@ type FullResponse struct {
 	CapacityMD   string    `json:"capacity_md,omitempty"`
 	BreakdownMD  string    `json:"breakdown_md,omitempty"`
 	TradeoffsMD  string    `json:"tradeoffs_md,omitempty"`
+	// Usage is keyed by prompt ID for diagram prompts, or "json_batch"
+	// for the combined JSON-batch call that produces the *_md fields.
+	Usage map[string]llm.Usage `json:"usage,omitempty"`
+	// Errors lists any prompt that timed out or failed. The response is
+	// still HTTP 200 with whatever sections did complete; failed prompt
+	// IDs can be regenerated alone via POST /full/retry.
+	Errors []PromptError `json:"errors,omitempty"`
+}
+
+// PromptError records a single prompt's failure (including a timeout)
+// so a client knows exactly what to retry instead of regenerating the
+// whole document.
+type PromptError struct {
+	PromptID  string `json:"prompt_id"`
+	Error     string `json:"error"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// ArtifactEvent is a single unit of progress produced while generating a
+// /full document: a finished diagram, a finished JSON-batch section, or
+// an error from one of the prompt goroutines, plus a terminal "done"
+// event once every prompt has resolved. SSE clients get these streamed
+// directly; the non-streaming path folds them into a FullResponse.
+type ArtifactEvent struct {
+	Kind      string          `json:"kind"` // "diagram", "section", or "done"
+	ID        string          `json:"id,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Err       string          `json:"err,omitempty"`
+	ElapsedMs int64           `json:"elapsed_ms,omitempty"`
+}
+
+// diagramPromptTypes maps a diagram prompt ID to its diagram type. Used
+// to split req.Prompts into diagram calls (one goroutine each, mermaid
+// output only) vs. the combined JSON batch (one call, many outputs).
+var diagramPromptTypes = map[string]string{
+	"mermaid_component":  "component",
+	"mermaid_deployment": "deployment",
+	"mermaid_sequence":   "sequence",
 }
 
 type FullHandler struct {
-	orClient *openrouter.Client
+	provider llm.Provider
 }
 
-func NewFullHandler(orClient *openrouter.Client) *FullHandler {
-	return &FullHandler{orClient: orClient}
+func NewFullHandler(provider llm.Provider) *FullHandler {
+	return &FullHandler{provider: provider}
 }
 
+// ServeHTTP generates every requested prompt concurrently. Clients that
+// send Accept: text/event-stream get each section as it finishes;
+// everyone else gets the old single JSON blob once all sections land.
 func (h *FullHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var req FullRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -50,191 +109,328 @@ func (h *FullHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	fullResp, err := h.generateCombined(r.Context(), w, &req)
-	if err != nil {
-		// Error is already handled in generateCombined
+	events := h.generateCombined(r.Context(), &req)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.serveStream(w, events)
 		return
 	}
 
+	h.respondJSON(w, events)
+}
+
+// RetryRequest re-runs a subset of prompts from a previous /full call -
+// just the prompt IDs that came back in FullResponse.Errors - instead of
+// regenerating the whole document.
+type RetryRequest struct {
+	DocGenRequest
+	PromptIDs               []string `json:"prompt_ids"`
+	PerPromptTimeoutSeconds int      `json:"per_prompt_timeout_seconds,omitempty"`
+}
+
+// HandleRetry regenerates only the requested prompt IDs, returning the
+// same FullResponse shape as /full so a client can merge it into the
+// sections it already has.
+func (h *FullHandler) HandleRetry(w http.ResponseWriter, r *http.Request) {
+	var req RetryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.PromptIDs) == 0 {
+		http.Error(w, "prompt_ids must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	fullReq := &FullRequest{
+		DocGenRequest:           req.DocGenRequest,
+		Prompts:                 req.PromptIDs,
+		PerPromptTimeoutSeconds: req.PerPromptTimeoutSeconds,
+	}
+	events := h.generateCombined(r.Context(), fullReq)
+	h.respondJSON(w, events)
+}
+
+// respondJSON folds a completed event stream into a FullResponse and
+// writes it - always 200, since a partial document (with Errors
+// populated) is still a usable response.
+func (h *FullHandler) respondJSON(w http.ResponseWriter, events <-chan ArtifactEvent) {
+	fullResp := aggregateEvents(events)
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(fullResp); err != nil {
 		slog.Error("failed to write response", "error", err)
 	}
 }
 
-func (h *FullHandler) generateCombined(ctx context.Context, w http.ResponseWriter, req *FullRequest) (*FullResponse, error) {
-	var combinedPrompt strings.Builder
-	var expectedOutputs []string
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	fullResp := &FullResponse{}
+// serveStream relays each ArtifactEvent to the client as it arrives,
+// framed as "event: section\ndata: {...}\n\n" (or "event: done" for the
+// terminal event), so the UI can render sections progressively instead
+// of waiting on the slowest prompt.
+func (h *FullHandler) serveStream(w http.ResponseWriter, events <-chan ArtifactEvent) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
 
-	// This map is used to determine which prompts are for diagrams and which are for JSON.
-	diagramPrompts := map[string]string{
-		"mermaid_component":  "component",
-		"mermaid_deployment": "deployment",
-		"mermaid_sequence":   "sequence",
+	for ev := range events {
+		event := "section"
+		if ev.Kind == "done" {
+			event = "done"
+		}
+		writeSSE(w, flusher, event, ev)
 	}
+}
+
+// generateCombined spawns one goroutine per diagram prompt plus one for
+// the combined JSON batch, each pushing its result onto a shared channel
+// as soon as it resolves. The channel is closed after a final "done"
+// event carrying the aggregate usage summary.
+func (h *FullHandler) generateCombined(ctx context.Context, req *FullRequest) <-chan ArtifactEvent {
+	events := make(chan ArtifactEvent)
+	timeout := perPromptTimeout(req.PerPromptTimeoutSeconds)
+
+	go func() {
+		defer close(events)
+
+		var wg sync.WaitGroup
+		var usageMu sync.Mutex
+		usage := make(map[string]llm.Usage)
+
+		var jsonPromptIDs []string
+		for _, promptID := range req.Prompts {
+			diagramType, isDiagram := diagramPromptTypes[promptID]
+			if !isDiagram {
+				jsonPromptIDs = append(jsonPromptIDs, promptID)
+				continue
+			}
 
-	// Separate prompts into diagram prompts and JSON prompts.
-	var jsonPromptIDs []string
-	for _, promptID := range req.Prompts {
-		if _, isDiagram := diagramPrompts[promptID]; isDiagram {
 			wg.Add(1)
-			// Handle diagram prompts separately
-			go func(pID string) {
+			go func(promptID, diagramType string) {
 				defer wg.Done()
-				rawJSON, err := CallOpenRouter(ctx, w, h.orClient, pID, &req.DocGenRequest)
+				start := time.Now()
+				promptCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+
+				d, promptUsage, err := h.generateDiagram(promptCtx, promptID, diagramType, &req.DocGenRequest)
 				if err != nil {
-					// Error handling for diagram generation
+					slog.Error("failed to generate diagram", "error", err, "prompt_id", promptID)
+					events <- ArtifactEvent{Kind: "diagram", ID: promptID, Err: err.Error(), ElapsedMs: time.Since(start).Milliseconds()}
 					return
 				}
-				// Assuming rawJSON contains just the Mermaid code string
-				// Trim surrounding quotes/backticks/whitespace from the returned code
-				code := strings.Trim(string(rawJSON), " `\"") // Remove quotes/backticks and trim whitespace
-				mu.Lock()
-				fullResp.Diagrams = append(fullResp.Diagrams, Diagram{
-					ID:       pID,
-					Type:     diagramPrompts[pID],
-					Language: "mermaid",
-					Code:     code,
-				})
-				mu.Unlock()
-			}(promptID)
-		} else {
-			jsonPromptIDs = append(jsonPromptIDs, promptID)
+				usageMu.Lock()
+				usage[promptID] = promptUsage
+				usageMu.Unlock()
+				payload, _ := json.Marshal(d)
+				events <- ArtifactEvent{Kind: "diagram", ID: promptID, Payload: payload}
+			}(promptID, diagramType)
 		}
-	}
 
-	// Process JSON prompts if any exist
-	if len(jsonPromptIDs) > 0 {
-		// Fetch prompt templates and build the combined prompt for JSON generation
-		for _, promptID := range jsonPromptIDs {
-			p, err := prompts.GetPrompt(promptID)
-			if err != nil {
-				slog.Error("failed to get prompt", "error", err)
-				return nil, err
-			}
-			combinedPrompt.WriteString(p.Template)
-			combinedPrompt.WriteString("\n\n")
-			expectedOutputs = append(expectedOutputs, p.Outputs...)
+		if len(jsonPromptIDs) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				promptCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+
+				sections, batchUsage, err := h.generateJSONBatch(promptCtx, jsonPromptIDs, &req.DocGenRequest)
+				if err != nil {
+					slog.Error("failed to generate json batch", "error", err)
+					elapsed := time.Since(start).Milliseconds()
+					for _, promptID := range jsonPromptIDs {
+						events <- ArtifactEvent{Kind: "section", ID: promptID, Err: err.Error(), ElapsedMs: elapsed}
+					}
+					return
+				}
+				usageMu.Lock()
+				usage["json_batch"] = batchUsage
+				usageMu.Unlock()
+				for outputKey, value := range sections {
+					payload, err := json.Marshal(value)
+					if err != nil {
+						continue
+					}
+					events <- ArtifactEvent{Kind: "section", ID: outputKey, Payload: payload}
+				}
+			}()
 		}
 
-		fullPrompt := combinedPrompt.String() + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
+		wg.Wait()
 
-		model := selectDefaultModel()
-		if req.Model != "" {
-			model = req.Model
-		}
+		slog.Info("full document usage", "prompt_count", len(req.Prompts), "usage", usage)
 
-		orReq := openrouter.ChatRequest{
-			Model: model,
-			Messages: []openrouter.Message{
-				{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
-				{Role: "user", Content: fullPrompt},
-			},
-			ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
-		}
+		donePayload, _ := json.Marshal(usage)
+		events <- ArtifactEvent{Kind: "done", Payload: donePayload}
+	}()
+
+	return events
+}
+
+// generateDiagram runs a single mermaid diagram prompt to completion.
+func (h *FullHandler) generateDiagram(ctx context.Context, promptID, diagramType string, req *DocGenRequest) (Diagram, llm.Usage, error) {
+	p, err := prompts.GetPrompt(promptID)
+	if err != nil {
+		return Diagram{}, llm.Usage{}, fmt.Errorf("get prompt %s: %w", promptID, err)
+	}
 
-		orResp, err := h.orClient.CreateChatCompletion(ctx, orReq)
+	fullPrompt := p.Template + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
+
+	llmReq := llm.Request{
+		Model: req.Model,
+		Messages: []llm.Message{
+			{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
+			{Role: "user", Content: fullPrompt},
+		},
+	}
+
+	// callProviderWithFallback walks defaultModelPolicy on a transient
+	// failure, as /plan and /design do (and as CallOpenRouter does for
+	// /summary), so a struggling model doesn't fail this diagram outright.
+	resp, attempts, err := callProviderWithFallback(ctx, h.provider, llmReq, nil)
+	slog.Info("llm call attempts", "prompt", promptID, "attempts", attempts)
+	if err != nil {
+		return Diagram{}, llm.Usage{}, fmt.Errorf("chat completion for %s: %w", promptID, err)
+	}
+
+	// Trim surrounding quotes/backticks/whitespace from the returned code.
+	code := strings.Trim(resp.Content, " `\"")
+	return Diagram{ID: promptID, Type: diagramType, Language: "mermaid", Code: code}, resp.Usage, nil
+}
+
+// generateJSONBatch runs every non-diagram prompt as a single combined
+// completion, then splits the parsed response back out by output key.
+func (h *FullHandler) generateJSONBatch(ctx context.Context, promptIDs []string, req *DocGenRequest) (map[string]interface{}, llm.Usage, error) {
+	var combinedPrompt strings.Builder
+	var expectedOutputs []string
+	for _, promptID := range promptIDs {
+		p, err := prompts.GetPrompt(promptID)
 		if err != nil {
-			slog.Error("failed to create chat completion", "error", err)
-			http.Error(w, "Failed to generate document", http.StatusInternalServerError)
-			return nil, err
+			return nil, llm.Usage{}, fmt.Errorf("get prompt %s: %w", promptID, err)
 		}
+		combinedPrompt.WriteString(p.Template)
+		combinedPrompt.WriteString("\n\n")
+		expectedOutputs = append(expectedOutputs, p.Outputs...)
+	}
+
+	fullPrompt := combinedPrompt.String() + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
 
-		if len(orResp.Choices) == 0 {
-			slog.Error("no choices returned from OpenRouter")
-			http.Error(w, "Failed to generate document", http.StatusInternalServerError)
-			return nil, fmt.Errorf("no choices returned from OpenRouter")
+	llmReq := llm.Request{
+		Model: req.Model,
+		Messages: []llm.Message{
+			{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
+			{Role: "user", Content: fullPrompt},
+		},
+		JSONMode: true,
+	}
+
+	// callProviderWithFallback walks defaultModelPolicy on a transient
+	// failure and repairs one malformed-JSON response per model, so a
+	// single bad completion doesn't fail the whole combined-sections
+	// batch the way a bare h.provider.Chat call would.
+	resp, attempts, err := callProviderWithFallback(ctx, h.provider, llmReq, expectedOutputs)
+	slog.Info("llm call attempts", "prompt", "json_batch", "attempts", attempts)
+	if err != nil {
+		return nil, llm.Usage{}, fmt.Errorf("chat completion for json batch: %w", err)
+	}
+
+	var llmResponse map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.Content), &llmResponse); err != nil {
+		return nil, llm.Usage{}, fmt.Errorf("unmarshal llm response: %w (response: %s)", err, resp.Content)
+	}
+
+	sections := make(map[string]interface{}, len(expectedOutputs))
+	for _, outputKey := range expectedOutputs {
+		if val, ok := llmResponse[outputKey]; ok {
+			sections[outputKey] = val
 		}
+	}
+	return sections, resp.Usage, nil
+}
 
-		var llmResponse map[string]interface{}
-		if err := json.Unmarshal([]byte(orResp.Choices[0].Message.Content), &llmResponse); err != nil {
-			slog.Error("failed to unmarshal LLM response into generic map", "error", err, "response", orResp.Choices[0].Message.Content)
-			http.Error(w, "Failed to parse LLM response", http.StatusInternalServerError)
-			return nil, err
+// aggregateEvents folds a completed event stream into the legacy
+// single-JSON-blob FullResponse, for clients that didn't ask for SSE. A
+// prompt that errored or timed out is recorded in Errors rather than
+// failing the whole response, so the caller still gets every section
+// that did complete.
+func aggregateEvents(events <-chan ArtifactEvent) *FullResponse {
+	fullResp := &FullResponse{}
+
+	for ev := range events {
+		if ev.Err != "" {
+			fullResp.Errors = append(fullResp.Errors, PromptError{
+				PromptID:  ev.ID,
+				Error:     ev.Err,
+				ElapsedMs: ev.ElapsedMs,
+			})
+			continue
 		}
 
-		for _, outputKey := range expectedOutputs {
-			switch outputKey {
-			case "summary_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.SummaryMD = val
-				}
-				break
-			case "plan_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.PlanMD = val
-				}
-				break
-			case "design_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.DesignMD = val
-				}
-				break
-			case "diagrams":
-				if val, ok := llmResponse[outputKey].([]interface{}); ok {
-					for _, diagram := range val {
-						if dMap, isMap := diagram.(map[string]interface{}); isMap {
-							d := Diagram{
-								ID:       fmt.Sprintf("%v", dMap["id"]),
-								Type:     fmt.Sprintf("%v", dMap["type"]),
-								Language: fmt.Sprintf("%v", dMap["language"]),
-								Code:     fmt.Sprintf("%v", dMap["code"]),
-							}
-							if title, ok := dMap["title"].(string); ok {
-								d.Title = title
-							}
-							fullResp.Diagrams = append(fullResp.Diagrams, d)
-						}
-					}
-				}
-				break
-			case "risks_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.RisksMD = val
-				}
-				break
-			case "acceptance_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.AcceptanceMD = val
-				}
-				break
-			case "testing_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.TestingMD = val
-				}
-				break
-			case "api_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.ApiMD = val
-				}
-				break
-			case "data_model_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.DataModelMD = val
-				}
-				break
-			case "capacity_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.CapacityMD = val
-				}
-				break
-			case "breakdown_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.BreakdownMD = val
-				}
-				break
-			case "tradeoffs_md":
-				if val, ok := llmResponse[outputKey].(string); ok {
-					fullResp.TradeoffsMD = val
-				}
-				break
+		switch ev.Kind {
+		case "diagram":
+			var d Diagram
+			if err := json.Unmarshal(ev.Payload, &d); err == nil {
+				fullResp.Diagrams = append(fullResp.Diagrams, d)
+			}
+		case "section":
+			applySection(fullResp, ev.ID, ev.Payload)
+		case "done":
+			var usage map[string]llm.Usage
+			if err := json.Unmarshal(ev.Payload, &usage); err == nil {
+				fullResp.Usage = usage
 			}
 		}
 	}
 
-	wg.Wait()
-	return fullResp, nil
+	return fullResp
+}
+
+// applySection unmarshals a single JSON-batch output into the matching
+// FullResponse field.
+func applySection(fullResp *FullResponse, outputKey string, payload json.RawMessage) {
+	switch outputKey {
+	case "summary_md":
+		unmarshalInto(payload, &fullResp.SummaryMD)
+	case "plan_md":
+		unmarshalInto(payload, &fullResp.PlanMD)
+	case "design_md":
+		unmarshalInto(payload, &fullResp.DesignMD)
+	case "diagrams":
+		var diagrams []Diagram
+		if json.Unmarshal(payload, &diagrams) == nil {
+			fullResp.Diagrams = append(fullResp.Diagrams, diagrams...)
+		}
+	case "risks_md":
+		unmarshalInto(payload, &fullResp.RisksMD)
+	case "acceptance_md":
+		unmarshalInto(payload, &fullResp.AcceptanceMD)
+	case "testing_md":
+		unmarshalInto(payload, &fullResp.TestingMD)
+	case "api_md":
+		unmarshalInto(payload, &fullResp.ApiMD)
+	case "data_model_md":
+		unmarshalInto(payload, &fullResp.DataModelMD)
+	case "capacity_md":
+		unmarshalInto(payload, &fullResp.CapacityMD)
+	case "breakdown_md":
+		unmarshalInto(payload, &fullResp.BreakdownMD)
+	case "tradeoffs_md":
+		unmarshalInto(payload, &fullResp.TradeoffsMD)
+	}
+}
+
+func unmarshalInto(payload json.RawMessage, dst *string) {
+	var v string
+	if json.Unmarshal(payload, &v) == nil {
+		*dst = v
+	}
 }
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"services/docgen-go/artifact"
+	"services/docgen-go/prompts"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// JobsHandler runs /full generation in the background, writing each
+// section into the job's artifact directory as it lands instead of
+// blocking the request on the slowest prompt.
+type JobsHandler struct {
+	full  *FullHandler
+	store *artifact.Store
+}
+
+func NewJobsHandler(full *FullHandler, store *artifact.Store) *JobsHandler {
+	return &JobsHandler{full: full, store: store}
+}
+
+// StartJobResponse is returned immediately when a job is created.
+type StartJobResponse struct {
+	JobID string `json:"job_id"`
+}
+
+// HandleStart creates a new job, kicks off generation in the
+// background, and returns its ID immediately.
+func (h *JobsHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	var req FullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	art, err := h.store.CreateNew()
+	if err != nil {
+		slog.Error("failed to create artifact", "error", err)
+		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+		return
+	}
+
+	sections := make(map[string]int, len(req.Prompts))
+	for _, p := range req.Prompts {
+		sections[p] = 0
+	}
+	if err := art.SaveStatus(artifact.JobStatus{State: "running", Sections: sections}); err != nil {
+		slog.Error("failed to save job status", "error", err)
+		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+		return
+	}
+
+	go h.run(art, &req, sections)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(StartJobResponse{JobID: art.ID}); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+// run drains the generation event stream, persisting each section into
+// the artifact directory and updating status.json as it goes.
+func (h *JobsHandler) run(art *artifact.Artifact, req *FullRequest, sections map[string]int) {
+	events := h.full.generateCombined(context.Background(), req)
+
+	// JSON-batch section events carry an output key (e.g. "summary_md");
+	// map it back to the prompt producing it so sections stays keyed by
+	// prompt ID.
+	promptForOutput := make(map[string]string)
+	for _, id := range req.Prompts {
+		if p, err := prompts.GetPrompt(id); err == nil {
+			for _, out := range p.Outputs {
+				promptForOutput[out] = id
+			}
+		}
+	}
+
+	failed := false
+	for ev := range events {
+		if ev.Kind == "done" {
+			continue
+		}
+		sectionID := ev.ID
+		if id, ok := promptForOutput[ev.ID]; ok && ev.Kind == "section" {
+			sectionID = id
+		}
+
+		if ev.Err != "" {
+			slog.Error("job section failed", "job_id", art.ID, "kind", ev.Kind, "id", ev.ID, "error", ev.Err)
+			sections[sectionID] = -1
+			failed = true
+			h.saveProgress(art, sections, "running")
+			continue
+		}
+
+		filename, data := sectionFile(ev)
+		if _, err := art.WriteFile(filename, data); err != nil {
+			slog.Error("failed to write job section", "job_id", art.ID, "filename", filename, "error", err)
+			sections[sectionID] = -1
+			failed = true
+			h.saveProgress(art, sections, "running")
+			continue
+		}
+		sections[sectionID] = 100
+		h.saveProgress(art, sections, "running")
+	}
+
+	state := "complete"
+	if failed {
+		state = "error"
+	}
+	h.saveProgress(art, sections, state)
+}
+
+func (h *JobsHandler) saveProgress(art *artifact.Artifact, sections map[string]int, state string) {
+	if err := art.SaveStatus(artifact.JobStatus{State: state, Sections: sections}); err != nil {
+		slog.Error("failed to save job status", "job_id", art.ID, "error", err)
+	}
+}
+
+// sectionFile picks a filename and raw bytes to persist for an
+// ArtifactEvent: diagram code as "<id>.mmd", string sections as
+// "<id>.md", anything else as "<id>.json".
+func sectionFile(ev ArtifactEvent) (string, []byte) {
+	if ev.Kind == "diagram" {
+		var d Diagram
+		if err := json.Unmarshal(ev.Payload, &d); err != nil {
+			return fmt.Sprintf("%s.json", ev.ID), ev.Payload
+		}
+		return fmt.Sprintf("%s.mmd", ev.ID), []byte(d.Code)
+	}
+
+	var s string
+	if err := json.Unmarshal(ev.Payload, &s); err == nil {
+		return fmt.Sprintf("%s.md", ev.ID), []byte(s)
+	}
+	return fmt.Sprintf("%s.json", ev.ID), ev.Payload
+}
+
+// HandleStatus reports a job's state and per-section progress so
+// clients can poll until generation finishes.
+func (h *JobsHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	status, err := h.store.Status(jobID)
+	if err != nil {
+		slog.Warn("job not found", "job_id", jobID, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
-	"services/docgen-go/openrouter"
+	"services/docgen-go/llm"
 	"services/docgen-go/prompts"
 )
 
@@ -14,11 +14,11 @@ type PlanResponse struct {
 }
 
 type PlanHandler struct {
-	orClient *openrouter.Client
+	provider llm.Provider
 }
 
-func NewPlanHandler(orClient *openrouter.Client) *PlanHandler {
-	return &PlanHandler{orClient: orClient}
+func NewPlanHandler(provider llm.Provider) *PlanHandler {
+	return &PlanHandler{provider: provider}
 }
 
 func (h *PlanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -38,37 +38,31 @@ func (h *PlanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	fullPrompt := p.Template + "\n\nProblem Title: " + req.Title + "\nProblem Description: " + req.Description
 
-	model := "openrouter/auto"
-	if req.Model != "" {
-		model = req.Model
-	}
-
-	orReq := openrouter.ChatRequest{
-		Model: model,
-		Messages: []openrouter.Message{
+	llmReq := llm.Request{
+		Model: req.Model,
+		Messages: []llm.Message{
 			{Role: "system", Content: "You are a helpful assistant that generates documents based on user input."},
 			{Role: "user", Content: fullPrompt},
 		},
-		ResponseFormat: &openrouter.ResponseFormat{Type: "json_object"},
+		JSONMode: true,
 	}
 
-	orResp, err := h.orClient.CreateChatCompletion(r.Context(), orReq)
+	// callProviderWithFallback walks defaultModelPolicy (including
+	// substituting a default when req.Model is empty) on a transient
+	// failure and repairs one malformed-JSON response per model, the
+	// same as /full and /jobs, instead of failing outright on the first
+	// bad completion.
+	resp, attempts, err := callProviderWithFallback(r.Context(), h.provider, llmReq, p.Outputs)
+	slog.Info("llm call attempts", "prompt", "solution_plan", "attempts", attempts)
 	if err != nil {
 		slog.Error("failed to create chat completion", "error", err)
 		http.Error(w, "Failed to generate plan", http.StatusInternalServerError)
 		return
 	}
 
-	if len(orResp.Choices) == 0 {
-		slog.Error("no choices returned from OpenRouter")
-		http.Error(w, "Failed to generate plan", http.StatusInternalServerError)
-		return
-	}
-
 	var planResp PlanResponse
-	err = json.Unmarshal([]byte(orResp.Choices[0].Message.Content), &planResp)
-	if err != nil {
-		slog.Error("failed to unmarshal LLM response", "error", err, "response", orResp.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(resp.Content), &planResp); err != nil {
+		slog.Error("failed to unmarshal LLM response", "error", err, "response", resp.Content)
 		http.Error(w, "Failed to parse LLM response", http.StatusInternalServerError)
 		return
 	}
@@ -78,3 +72,16 @@ func (h *PlanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.Error("failed to write response", "error", err)
 	}
 }
+
+// ServeStream streams the solution plan over Server-Sent Events as it's
+// generated, instead of blocking until the full completion lands.
+func (h *PlanHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	var req DocGenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	StreamOpenRouter(r.Context(), w, h.provider, "solution_plan", &req)
+}
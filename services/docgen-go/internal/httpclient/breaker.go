@@ -0,0 +1,83 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// hostBreaker is a simple closed/open/half-open circuit breaker scoped
+// to a single upstream host. It opens after failureThreshold consecutive
+// failures, fails fast while open, and after resetTimeout admits exactly
+// one half-open probe request to decide whether to close again.
+type hostBreaker struct {
+	failureThreshold int
+	resetTimeout     time.Duration
+
+	mu               sync.Mutex
+	state            breakerState
+	consecutiveFails int
+	openedAt         time.Time
+	probeInFlight    bool
+}
+
+// allow reports whether a request may proceed, transitioning the
+// breaker from open to half-open once resetTimeout has elapsed.
+func (b *hostBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probeInFlight = true
+		return true
+	case breakerHalfOpen:
+		// Only the single request that flipped us into half-open gets
+		// through; everything else fails fast until that probe resolves.
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *hostBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.consecutiveFails = 0
+	b.probeInFlight = false
+}
+
+func (b *hostBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		// The probe failed; go straight back to open for another full
+		// resetTimeout rather than counting toward failureThreshold again.
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.probeInFlight = false
+		return
+	}
+
+	b.consecutiveFails++
+	if b.consecutiveFails >= b.failureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostBreakerOpensAfterThreshold(t *testing.T) {
+	b := &hostBreaker{failureThreshold: 3, resetTimeout: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("expected breaker to allow request %d before threshold", i)
+		}
+		b.recordFailure()
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("expected breaker to stay closed below threshold, got state %v", b.state)
+	}
+
+	b.recordFailure()
+	if b.state != breakerOpen {
+		t.Fatalf("expected breaker to open at threshold, got state %v", b.state)
+	}
+	if b.allow() {
+		t.Error("expected breaker to fail fast while open")
+	}
+}
+
+func TestHostBreakerRecordSuccessResetsFailureCount(t *testing.T) {
+	b := &hostBreaker{failureThreshold: 3, resetTimeout: time.Hour}
+
+	b.recordFailure()
+	b.recordFailure()
+	b.recordSuccess()
+	if b.state != breakerClosed || b.consecutiveFails != 0 {
+		t.Fatalf("expected recordSuccess to reset state to closed/0, got state=%v consecutiveFails=%d", b.state, b.consecutiveFails)
+	}
+
+	// A fresh run of failures below threshold shouldn't open the breaker,
+	// proving the earlier failures weren't still being counted.
+	b.recordFailure()
+	b.recordFailure()
+	if b.state != breakerClosed {
+		t.Fatalf("expected breaker to remain closed after reset, got state %v", b.state)
+	}
+}
+
+func TestHostBreakerHalfOpenAdmitsSingleProbe(t *testing.T) {
+	b := &hostBreaker{failureThreshold: 1, resetTimeout: 10 * time.Millisecond}
+
+	b.recordFailure()
+	if b.state != breakerOpen {
+		t.Fatalf("expected breaker to open after one failure at threshold 1, got state %v", b.state)
+	}
+	if b.allow() {
+		t.Error("expected breaker to fail fast immediately after opening")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected breaker to admit a half-open probe once resetTimeout has elapsed")
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("expected breaker to transition to half-open, got state %v", b.state)
+	}
+	if b.allow() {
+		t.Error("expected only the probe request to be admitted while half-open")
+	}
+}
+
+func TestHostBreakerHalfOpenProbeFailureReopens(t *testing.T) {
+	b := &hostBreaker{failureThreshold: 1, resetTimeout: 10 * time.Millisecond}
+
+	b.recordFailure()
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected breaker to admit a half-open probe")
+	}
+
+	b.recordFailure()
+	if b.state != breakerOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got state %v", b.state)
+	}
+	if b.allow() {
+		t.Error("expected breaker to fail fast again immediately after a failed probe")
+	}
+}
+
+func TestHostBreakerHalfOpenProbeSuccessCloses(t *testing.T) {
+	b := &hostBreaker{failureThreshold: 1, resetTimeout: 10 * time.Millisecond}
+
+	b.recordFailure()
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected breaker to admit a half-open probe")
+	}
+
+	b.recordSuccess()
+	if b.state != breakerClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got state %v", b.state)
+	}
+	if !b.allow() {
+		t.Error("expected breaker to allow requests again once closed")
+	}
+}
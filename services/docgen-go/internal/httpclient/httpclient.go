@@ -1,46 +1,144 @@
 package httpclient
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"math"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 )
 
-// RetryableClient is a wrapper around http.Client that provides retry logic.
+const (
+	defaultFailureThreshold = 5
+	defaultResetTimeout     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned by Do when the per-host circuit breaker is
+// open and fails the request fast rather than hammering a struggling
+// upstream.
+var ErrCircuitOpen = errors.New("httpclient: circuit breaker open for host")
+
+// Config configures a RetryableClient. Zero values for FailureThreshold
+// and ResetTimeout fall back to sane defaults.
+type Config struct {
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+
+	// FailureThreshold is the number of consecutive failures (network
+	// errors or 5xx/429 responses) on a host before its breaker opens.
+	FailureThreshold int
+	// ResetTimeout is how long the breaker stays open before admitting a
+	// single half-open probe request.
+	ResetTimeout time.Duration
+
+	// OnRetry, if set, is called once per retry attempt (network error or
+	// 5xx/429 response). OnRateLimited, if set, is called whenever a 429
+	// response is received, including on the final attempt.
+	// Callers use these to feed metrics counters without this package
+	// depending on any particular metrics library.
+	OnRetry       func()
+	OnRateLimited func()
+}
+
+// RetryableClient is a wrapper around http.Client that provides retry
+// logic, Retry-After-aware backoff, and a per-host circuit breaker.
 type RetryableClient struct {
-	httpClient *http.Client
-	retries    int
-	backoff    time.Duration
+	httpClient       *http.Client
+	retries          int
+	backoff          time.Duration
+	failureThreshold int
+	resetTimeout     time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*hostBreaker
+
+	onRetry       func()
+	onRateLimited func()
 }
 
-// New creates a new RetryableClient.
+// New creates a new RetryableClient with the circuit breaker defaults.
+// Use NewWithConfig to override FailureThreshold/ResetTimeout.
 func New(timeout time.Duration, retries int, backoff time.Duration) *RetryableClient {
+	return NewWithConfig(Config{Timeout: timeout, Retries: retries, Backoff: backoff})
+}
+
+// NewWithConfig creates a new RetryableClient from a Config.
+func NewWithConfig(cfg Config) *RetryableClient {
+	failureThreshold := cfg.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = defaultFailureThreshold
+	}
+	resetTimeout := cfg.ResetTimeout
+	if resetTimeout <= 0 {
+		resetTimeout = defaultResetTimeout
+	}
+
 	return &RetryableClient{
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
-		retries: retries,
-		backoff: backoff,
+		httpClient:       &http.Client{Timeout: cfg.Timeout},
+		retries:          cfg.Retries,
+		backoff:          cfg.Backoff,
+		failureThreshold: failureThreshold,
+		resetTimeout:     resetTimeout,
+		breakers:         make(map[string]*hostBreaker),
+		onRetry:          cfg.OnRetry,
+		onRateLimited:    cfg.OnRateLimited,
 	}
 }
 
-// Do executes an HTTP request with retry logic.
+// Do executes an HTTP request with retry logic. The request body (if
+// any) is buffered up front so it can be safely replayed across
+// retries, even for non-seekable io.Reader bodies such as bytes.Buffer
+// wrapped in io.NopCloser.
 func (c *RetryableClient) Do(req *http.Request) (*http.Response, error) {
+	br := c.breakerFor(req.URL.Host)
+	if !br.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	bodyBytes, err := bufferBody(req)
+	if err != nil {
+		return nil, err
+	}
+
 	var resp *http.Response
-	var err error
 
 	for i := 0; i <= c.retries; i++ {
+		if bodyBytes != nil {
+			req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		}
+
 		resp, err = c.httpClient.Do(req)
 		if err != nil {
-			// If there is a network error, we can retry
+			br.recordFailure()
+			c.notifyRetry(i)
 			time.Sleep(c.getBackoffWithJitter(i))
 			continue
 		}
 
-		// Retry on 429 or 5xx status codes
-		if resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && resp.StatusCode <= 599) {
-			// It's important to close the response body to avoid leaking connections
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			br.recordFailure()
+			c.notifyRetry(i)
+			if resp.StatusCode == http.StatusTooManyRequests && c.onRateLimited != nil {
+				c.onRateLimited()
+			}
+			wait := retryAfterDelay(resp.Header.Get("Retry-After"))
+			if wait <= 0 {
+				wait = c.getBackoffWithJitter(i)
+			}
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+			time.Sleep(wait)
+			continue
+		}
+
+		if resp.StatusCode >= 500 && resp.StatusCode <= 599 {
+			br.recordFailure()
+			c.notifyRetry(i)
 			if resp.Body != nil {
 				resp.Body.Close()
 			}
@@ -48,13 +146,21 @@ func (c *RetryableClient) Do(req *http.Request) (*http.Response, error) {
 			continue
 		}
 
-		// If the status code is not a server error, we are done
+		br.recordSuccess()
 		return resp, nil
 	}
 
 	return resp, err
 }
 
+// notifyRetry reports a failed attempt to onRetry only when another
+// attempt follows it.
+func (c *RetryableClient) notifyRetry(attempt int) {
+	if c.onRetry != nil && attempt < c.retries {
+		c.onRetry()
+	}
+}
+
 func (c *RetryableClient) getBackoffWithJitter(attempt int) time.Duration {
 	if attempt == 0 {
 		return c.backoff
@@ -64,3 +170,32 @@ func (c *RetryableClient) getBackoffWithJitter(attempt int) time.Duration {
 	jitter := (rand.Float64() - 0.5) * backoff * 0.5 // Jitter up to 25%
 	return time.Duration(backoff + jitter)
 }
+
+func (c *RetryableClient) breakerFor(host string) *hostBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	br, ok := c.breakers[host]
+	if !ok {
+		br = &hostBreaker{failureThreshold: c.failureThreshold, resetTimeout: c.resetTimeout}
+		c.breakers[host] = br
+	}
+	return br
+}
+
+// bufferBody drains req.Body into memory (if present) so the caller can
+// rewind it across retry attempts. http.Request already buffers bodies
+// created from []byte/string/bytes.Buffer via GetBody, but arbitrary
+// io.Reader bodies (e.g. a streaming upload) have no GetBody and would
+// otherwise be sent empty on retry.
+func bufferBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
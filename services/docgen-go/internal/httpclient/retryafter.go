@@ -0,0 +1,34 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryAfterDelay parses a Retry-After header value in either its
+// delay-seconds form ("120") or HTTP-date form
+// ("Fri, 31 Dec 1999 23:59:59 GMT"). It returns 0 if header is empty or
+// unparseable, letting the caller fall back to its own backoff.
+func retryAfterDelay(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(header); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			return 0
+		}
+		return delay
+	}
+
+	return 0
+}
@@ -0,0 +1,93 @@
+// Package metrics holds the Prometheus collectors shared across the
+// docgen service and the /metrics HTTP handler that exposes them.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTPRequestDuration is recorded by the chi middleware for every
+	// request, keyed by route pattern/method/status.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docgen_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route, method, and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// OpenRouterRequestDuration times CreateChatCompletion calls.
+	OpenRouterRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docgen_openrouter_request_duration_seconds",
+		Help:    "Duration of OpenRouter chat completion calls by model and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"model", "status"})
+
+	// OpenRouterTokensTotal tallies Usage.PromptTokens/CompletionTokens
+	// reported on each completion, labeled by model and "prompt"/"completion".
+	OpenRouterTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docgen_openrouter_tokens_total",
+		Help: "Total tokens reported by OpenRouter completions, by model and kind.",
+	}, []string{"model", "kind"})
+
+	// OpenRouterCostTotal tallies Usage.Cost (USD) reported on each
+	// completion, labeled by model, for cost visibility across the
+	// models tried in the handlers' model fallback chain.
+	OpenRouterCostTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docgen_openrouter_cost_usd_total",
+		Help: "Total USD cost reported by OpenRouter completions, by model.",
+	}, []string{"model"})
+
+	// OpenRouterRetriesTotal counts retry attempts made by the shared
+	// httpclient.RetryableClient used by the OpenRouter client.
+	OpenRouterRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "docgen_openrouter_retries_total",
+		Help: "Total retry attempts made against the OpenRouter API.",
+	})
+
+	// OpenRouterRateLimitedTotal counts 429 responses observed from OpenRouter.
+	OpenRouterRateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "docgen_openrouter_rate_limited_total",
+		Help: "Total 429 responses observed from the OpenRouter API.",
+	})
+
+	// ExportBundleSizeBytes records the size of uploaded export bundles by format.
+	ExportBundleSizeBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docgen_export_bundle_size_bytes",
+		Help:    "Size in bytes of uploaded export bundles by format.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+	}, []string{"format"})
+
+	// ExportRenderDuration times ExportHandler's render step by format.
+	ExportRenderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docgen_export_render_duration_seconds",
+		Help:    "Duration of export bundle rendering by format.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"format"})
+
+	// ArtifactCount is the current number of on-disk artifact bundles.
+	ArtifactCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "docgen_artifact_count",
+		Help: "Current number of on-disk artifact bundles.",
+	})
+
+	// ArtifactBytes is the current total bytes used by on-disk artifact blobs.
+	ArtifactBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "docgen_artifact_bytes",
+		Help: "Current total bytes used by on-disk artifact blobs.",
+	})
+
+	// JanitorEvictionsTotal counts artifact directories removed by the janitor for TTL expiry.
+	JanitorEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "docgen_janitor_evictions_total",
+		Help: "Total artifact directories evicted by the janitor.",
+	})
+)
+
+// Handler returns the http.Handler that serves the /metrics endpoint.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Middleware records each request's duration against HTTPRequestDuration,
+// labeled by the matched chi route pattern, method, and status code. The
+// request_id set by middleware.RequestID is attached as an exemplar
+// label. The service's slog lines, including the OpenRouter completion
+// log with its completion ID, do not record request_id.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		observer := HTTPRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(ww.Status()))
+		observeWithRequestID(observer, time.Since(start).Seconds(), middleware.GetReqID(r.Context()))
+	})
+}
+
+// observeWithRequestID attaches requestID as an exemplar label when the
+// observer supports exemplars, falling back to a plain observation
+// otherwise (e.g. when running against a Prometheus client built without
+// exemplar support).
+func observeWithRequestID(observer prometheus.Observer, value float64, requestID string) {
+	if requestID == "" {
+		observer.Observe(value)
+		return
+	}
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(value, prometheus.Labels{"request_id": requestID})
+		return
+	}
+	observer.Observe(value)
+}
@@ -0,0 +1,89 @@
+// Package llm abstracts chat-completion calls behind a vendor-neutral
+// Provider interface so handlers aren't hard-wired to OpenRouter. Router
+// composes several Providers with fallback, so a self-hosted deployment
+// can route entirely to a local Ollama/vLLM instance and avoid egress.
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a single chat message.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Request is a vendor-neutral chat completion request.
+type Request struct {
+	Model    string
+	Messages []Message
+	// JSONMode requests (and, where the provider can verify it, enforces)
+	// a JSON-object response.
+	JSONMode bool
+}
+
+// Response is a vendor-neutral chat completion response.
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+}
+
+// Usage summarizes token counts (and, when the provider reports it,
+// cost in USD) for a single completion.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Cost             float64
+}
+
+// StreamEvent is a single delta emitted while streaming a chat
+// completion. Err is set (with Delta empty) if the stream fails
+// mid-flight.
+type StreamEvent struct {
+	Delta string
+	Err   error
+}
+
+// Stream is an in-flight streamed chat completion.
+type Stream interface {
+	Events() <-chan StreamEvent
+}
+
+// Provider is a single LLM backend (OpenRouter, Anthropic, OpenAI, a
+// local Ollama/vLLM instance, ...).
+type Provider interface {
+	// Name identifies the provider in logs and fallback decisions.
+	Name() string
+	Chat(ctx context.Context, req Request) (Response, error)
+	ChatStream(ctx context.Context, req Request) (Stream, error)
+}
+
+// ErrInvalidJSON is returned by a Provider's Chat method when the caller
+// requested JSONMode but the completion content isn't valid JSON.
+var ErrInvalidJSON = errors.New("llm: provider returned invalid JSON for json-mode request")
+
+// InvalidJSONError wraps ErrInvalidJSON with the malformed completion
+// content, so a caller that wants to attempt a repair (re-sending the
+// content with a "return only valid JSON" instruction) doesn't need a
+// second round-trip just to recover what the model actually said.
+type InvalidJSONError struct {
+	Content string
+}
+
+func (e *InvalidJSONError) Error() string {
+	return ErrInvalidJSON.Error() + ": " + e.Content
+}
+
+func (e *InvalidJSONError) Unwrap() error { return ErrInvalidJSON }
+
+// ErrUnauthorized and ErrRateLimited are vendor-neutral classifications
+// a Provider should wrap its own auth/rate-limit errors in, so Router
+// can decide to fall through without importing every provider package.
+var (
+	ErrUnauthorized = errors.New("llm: provider rejected credentials")
+	ErrRateLimited  = errors.New("llm: provider rate limited the request")
+)
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"services/docgen-go/internal/httpclient"
+)
+
+// ProviderConfig pairs a Provider with the subset of models the Router
+// is allowed to send it. An empty ModelAllowlist means "any model".
+type ProviderConfig struct {
+	Provider       Provider
+	ModelAllowlist []string
+}
+
+// Router tries an ordered list of providers, falling through to the
+// next one on auth failures, rate limiting, an open circuit breaker, or
+// invalid JSON, so a single struggling vendor doesn't take the whole
+// service down.
+type Router struct {
+	providers []ProviderConfig
+}
+
+// NewRouter creates a Router over the given providers, tried in order.
+// Router itself implements Provider, so it can be handed to anything
+// that accepts a single Provider.
+func NewRouter(providers ...ProviderConfig) *Router {
+	return &Router{providers: providers}
+}
+
+// Name identifies the router in logs.
+func (r *Router) Name() string {
+	return "router"
+}
+
+// Chat walks the provider list in order, returning the first successful
+// response. If req.Model is set and a provider's allowlist doesn't
+// include it, that provider is skipped entirely.
+func (r *Router) Chat(ctx context.Context, req Request) (Response, error) {
+	var lastErr error
+
+	for _, pc := range r.providers {
+		attempt := req
+		if len(pc.ModelAllowlist) > 0 {
+			if attempt.Model == "" {
+				attempt.Model = pc.ModelAllowlist[0]
+			} else if !contains(pc.ModelAllowlist, attempt.Model) {
+				continue
+			}
+		}
+
+		resp, err := pc.Provider.Chat(ctx, attempt)
+		if err == nil {
+			return resp, nil
+		}
+
+		if !shouldFallback(err) {
+			return Response{}, err
+		}
+
+		slog.Warn("llm provider failed, falling back to next provider",
+			"provider", pc.Provider.Name(), "error", err)
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return Response{}, errors.New("llm: no providers configured")
+	}
+	return Response{}, fmt.Errorf("llm: all providers exhausted, last error: %w", lastErr)
+}
+
+// ChatStream streams from the first provider whose allowlist admits the
+// requested model. Once a stream has started, failures cannot be
+// transparently retried on another provider without replaying tokens
+// already sent to the caller, so ChatStream does not fall through
+// mid-stream the way Chat does.
+func (r *Router) ChatStream(ctx context.Context, req Request) (Stream, error) {
+	var lastErr error
+
+	for _, pc := range r.providers {
+		attempt := req
+		if len(pc.ModelAllowlist) > 0 {
+			if attempt.Model == "" {
+				attempt.Model = pc.ModelAllowlist[0]
+			} else if !contains(pc.ModelAllowlist, attempt.Model) {
+				continue
+			}
+		}
+
+		stream, err := pc.Provider.ChatStream(ctx, attempt)
+		if err == nil {
+			return stream, nil
+		}
+
+		if !shouldFallback(err) {
+			return nil, err
+		}
+
+		slog.Warn("llm provider failed to start stream, falling back to next provider",
+			"provider", pc.Provider.Name(), "error", err)
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return nil, errors.New("llm: no providers configured")
+	}
+	return nil, fmt.Errorf("llm: all providers exhausted, last error: %w", lastErr)
+}
+
+func shouldFallback(err error) bool {
+	return errors.Is(err, ErrUnauthorized) ||
+		errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, httpclient.ErrCircuitOpen) ||
+		errors.Is(err, ErrInvalidJSON)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
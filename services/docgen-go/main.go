@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
 	"services/docgen-go/artifact"
 	"services/docgen-go/handlers"
+	"services/docgen-go/internal/metrics"
+	"services/docgen-go/llm"
 	"services/docgen-go/openrouter"
 	"services/docgen-go/prompts"
+	"services/docgen-go/render"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -30,6 +34,13 @@ func main() {
 	}
 	slog.Info("Prompts loaded successfully")
 
+	// Watch for prompt template changes so edits take effect without a
+	// restart; a bad edit is logged and ignored rather than taken live.
+	if err := prompts.Watch(context.Background(), "./prompts"); err != nil {
+		slog.Error("failed to start prompt watcher", "error", err)
+		os.Exit(1)
+	}
+
 	// Create OpenRouter client
 	orClient, err := openrouter.NewClient()
 	if err != nil {
@@ -37,6 +48,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// llmRouter currently only has one provider configured, but handlers
+	// that take an llm.Provider are ready to fall through to additional
+	// providers (Anthropic, OpenAI, a local Ollama/vLLM instance, ...) as
+	// they're added here.
+	llmRouter := llm.NewRouter(llm.ProviderConfig{Provider: orClient})
+
 	// Create Artifact store
 	artifactStore, err := artifact.NewStore(artifactBasePath)
 	if err != nil {
@@ -51,6 +68,7 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(metrics.Middleware)
 
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -58,21 +76,39 @@ func main() {
 		w.Write([]byte(`{"status":"ok"}`))
 	})
 
+	// Prometheus scrape endpoint
+	r.Handle("/metrics", metrics.Handler())
+
 	// V1 routes
 	r.Route("/v1/docgen", func(r chi.Router) {
 		summaryHandler := handlers.NewSummaryHandler(orClient)
-		planHandler := handlers.NewPlanHandler(orClient)
-		designHandler := handlers.NewDesignHandler(orClient)
-		fullHandler := handlers.NewFullHandler()
-		exportHandler := handlers.NewExportHandler(artifactStore)
+		planHandler := handlers.NewPlanHandler(llmRouter)
+		designHandler := handlers.NewDesignHandler(llmRouter)
+		fullHandler := handlers.NewFullHandler(llmRouter)
+		jobsHandler := handlers.NewJobsHandler(fullHandler, artifactStore)
+		exportHandler := handlers.NewExportHandler(artifactStore, render.NewDefaultRegistry())
+		exportHandler.StartJanitor(janitorInterval)
 		filesHandler := handlers.NewFilesHandler(artifactStore)
+		artifactsHandler := handlers.NewArtifactsHandler(artifactStore)
 
 		r.Mount("/summary", summaryHandler)
+		r.Post("/summary/stream", summaryHandler.ServeStream)
 		r.Mount("/plan", planHandler)
+		r.Post("/plan/stream", planHandler.ServeStream)
 		r.Mount("/design", designHandler)
+		r.Post("/design/stream", designHandler.ServeStream)
 		r.Mount("/full", fullHandler)
-		r.Mount("/export", exportHandler)
+		r.Post("/full/retry", fullHandler.HandleRetry)
+		r.Post("/jobs", jobsHandler.HandleStart)
+		r.Get("/jobs/{jobID}", jobsHandler.HandleStatus)
+		r.Get("/artifacts/{id}/{filename}", artifactsHandler.ServeHTTP)
+		r.Post("/export", exportHandler.HandleStart)
+		r.Patch("/exports/{jobID}", exportHandler.HandleChunk)
+		r.Put("/exports/{jobID}", exportHandler.HandleFinalize)
+		r.Get("/exports/{jobID}", exportHandler.HandleStatus)
+		r.Get("/files/{id}/manifest.json", filesHandler.ServeManifest)
 		r.Get("/files/{id}/{filename}", filesHandler.ServeHTTP)
+		r.Head("/files/{id}/{filename}", filesHandler.ServeHead)
 	})
 
 	slog.Info("Starting server on :8080")
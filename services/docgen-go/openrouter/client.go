@@ -7,23 +7,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"services/docgen-go/internal/httpclient"
+	"services/docgen-go/internal/metrics"
+	"strconv"
 	"time"
 )
 
 var (
-	defaultTimeout   = 30 * time.Second
-	defaultRetries   = 1
-	defaultBackoff   = 2 * time.Second
-	openRouterAPIURL = "https://openrouter.ai/api/v1/chat/completions"
+	defaultTimeout                 = 30 * time.Second
+	defaultRetries                 = 1
+	defaultBackoff                 = 2 * time.Second
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerReset     = 30 * time.Second
+	openRouterAPIURL               = "https://openrouter.ai/api/v1/chat/completions"
 )
 
 var (
 	ErrUnauthorized = errors.New("unauthorized: check your OpenRouter API key")
 	ErrForbidden    = errors.New("forbidden: you do not have permission to access this resource")
 	ErrRateLimited  = errors.New("rate limited: too many requests")
+	// ErrServerError wraps any 5xx response. It's a distinct sentinel
+	// (rather than just the old 500-only fmt.Errorf) so callers can tell
+	// a transient server-side failure from a 4xx that would just fail
+	// identically against a different model.
+	ErrServerError = errors.New("openrouter server error")
 )
 
 // Client is a client for the OpenRouter API.
@@ -42,10 +52,18 @@ func NewClient() (*Client, error) {
 	}
 
 	return &Client{
-		httpClient: httpclient.New(defaultTimeout, defaultRetries, defaultBackoff),
-		apiKey:     apiKey,
-		referer:    os.Getenv("HTTP_REFERER"),
-		title:      os.Getenv("X_TITLE"),
+		httpClient: httpclient.NewWithConfig(httpclient.Config{
+			Timeout:          defaultTimeout,
+			Retries:          defaultRetries,
+			Backoff:          defaultBackoff,
+			FailureThreshold: defaultCircuitBreakerThreshold,
+			ResetTimeout:     defaultCircuitBreakerReset,
+			OnRetry:          func() { metrics.OpenRouterRetriesTotal.Inc() },
+			OnRateLimited:    func() { metrics.OpenRouterRateLimitedTotal.Inc() },
+		}),
+		apiKey:  apiKey,
+		referer: os.Getenv("HTTP_REFERER"),
+		title:   os.Getenv("X_TITLE"),
 	}, nil
 }
 
@@ -54,6 +72,7 @@ type ChatRequest struct {
 	Model          string          `json:"model"`
 	Messages       []Message       `json:"messages"`
 	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
 }
 
 // Message represents a single message in a chat conversation.
@@ -79,15 +98,23 @@ type Choice struct {
 	Message Message `json:"message"`
 }
 
-// Usage represents the token usage for a request.
+// Usage represents the token usage (and, when OpenRouter reports it,
+// the USD cost) for a request.
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost,omitempty"`
 }
 
 // CreateChatCompletion sends a chat completion request to the OpenRouter API.
 func (c *Client) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	start := time.Now()
+	status := "error"
+	defer func() {
+		metrics.OpenRouterRequestDuration.WithLabelValues(req.Model, status).Observe(time.Since(start).Seconds())
+	}()
+
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -106,6 +133,7 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatRequest) (*Ch
 	}
 	defer resp.Body.Close()
 
+	status = strconv.Itoa(resp.StatusCode)
 	if err := c.handleError(resp); err != nil {
 		return nil, err
 	}
@@ -120,6 +148,18 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatRequest) (*Ch
 		return nil, fmt.Errorf("failed to unmarshal response: %w (response: %s)", err, string(respBody))
 	}
 
+	metrics.OpenRouterTokensTotal.WithLabelValues(req.Model, "prompt").Add(float64(chatResp.Usage.PromptTokens))
+	metrics.OpenRouterTokensTotal.WithLabelValues(req.Model, "completion").Add(float64(chatResp.Usage.CompletionTokens))
+	metrics.OpenRouterCostTotal.WithLabelValues(req.Model).Add(chatResp.Usage.Cost)
+	slog.Info("openrouter completion usage",
+		"model", req.Model,
+		"completion_id", chatResp.ID,
+		"prompt_tokens", chatResp.Usage.PromptTokens,
+		"completion_tokens", chatResp.Usage.CompletionTokens,
+		"total_tokens", chatResp.Usage.TotalTokens,
+		"cost_usd", chatResp.Usage.Cost,
+	)
+
 	return &chatResp, nil
 }
 
@@ -139,15 +179,15 @@ func (c *Client) handleError(resp *http.Response) error {
 		return nil
 	}
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
 		return ErrUnauthorized
-	case http.StatusForbidden:
+	case resp.StatusCode == http.StatusForbidden:
 		return ErrForbidden
-	case http.StatusTooManyRequests:
+	case resp.StatusCode == http.StatusTooManyRequests:
 		return ErrRateLimited
-	case http.StatusInternalServerError:
-		return fmt.Errorf("internal server error: %s", resp.Status)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrServerError, resp.Status)
 	default:
 		return fmt.Errorf("received non-2xx status code: %d", resp.StatusCode)
 	}
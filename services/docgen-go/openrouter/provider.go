@@ -0,0 +1,92 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"services/docgen-go/llm"
+)
+
+// Name identifies this provider in llm.Router fallback logs.
+func (c *Client) Name() string {
+	return "openrouter"
+}
+
+// Chat implements llm.Provider by translating a vendor-neutral request
+// into an OpenRouter ChatRequest. When req.JSONMode is set, the
+// completion content is validated as JSON so llm.Router can fall
+// through to the next provider on a malformed response.
+func (c *Client) Chat(ctx context.Context, req llm.Request) (llm.Response, error) {
+	orReq := toChatRequest(req)
+
+	orResp, err := c.CreateChatCompletion(ctx, orReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			return llm.Response{}, fmt.Errorf("%w (%v)", llm.ErrUnauthorized, err)
+		case errors.Is(err, ErrRateLimited):
+			return llm.Response{}, fmt.Errorf("%w (%v)", llm.ErrRateLimited, err)
+		default:
+			return llm.Response{}, err
+		}
+	}
+	if len(orResp.Choices) == 0 {
+		return llm.Response{}, fmt.Errorf("openrouter: no choices returned")
+	}
+
+	content := orResp.Choices[0].Message.Content
+	if req.JSONMode && !json.Valid([]byte(content)) {
+		return llm.Response{}, &llm.InvalidJSONError{Content: content}
+	}
+
+	usage := llm.Usage{
+		PromptTokens:     orResp.Usage.PromptTokens,
+		CompletionTokens: orResp.Usage.CompletionTokens,
+		TotalTokens:      orResp.Usage.TotalTokens,
+		Cost:             orResp.Usage.Cost,
+	}
+	return llm.Response{Content: content, Model: req.Model, Usage: usage}, nil
+}
+
+// ChatStream implements llm.Provider by translating a vendor-neutral
+// request into an OpenRouter streaming request and adapting the
+// resulting Stream.
+func (c *Client) ChatStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	orReq := toChatRequest(req)
+
+	stream, err := c.CreateChatCompletionStream(ctx, orReq)
+	if err != nil {
+		return nil, err
+	}
+	return &streamAdapter{stream: stream}, nil
+}
+
+func toChatRequest(req llm.Request) ChatRequest {
+	messages := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = Message{Role: m.Role, Content: m.Content}
+	}
+
+	orReq := ChatRequest{Model: req.Model, Messages: messages}
+	if req.JSONMode {
+		orReq.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+	return orReq
+}
+
+// streamAdapter adapts an openrouter.Stream to the llm.Stream interface.
+type streamAdapter struct {
+	stream *Stream
+}
+
+func (s *streamAdapter) Events() <-chan llm.StreamEvent {
+	out := make(chan llm.StreamEvent)
+	go func() {
+		defer close(out)
+		for ev := range s.stream.Events() {
+			out <- llm.StreamEvent{Delta: ev.Delta, Err: ev.Err}
+		}
+	}()
+	return out
+}
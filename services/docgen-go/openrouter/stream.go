@@ -0,0 +1,118 @@
+package openrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamEvent is a single delta emitted while streaming a chat
+// completion. Err is set (with Delta empty) if the stream fails
+// mid-flight; the channel is closed immediately after.
+type StreamEvent struct {
+	Delta string
+	Err   error
+}
+
+// Stream represents an in-flight streamed chat completion.
+type Stream struct {
+	events chan StreamEvent
+}
+
+// Events returns the channel of streamed deltas. It is closed once the
+// upstream response reaches the "[DONE]" sentinel, EOFs, or errors.
+func (s *Stream) Events() <-chan StreamEvent {
+	return s.events
+}
+
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	// Error is set instead of Choices on OpenRouter's mid-stream error
+	// frame, e.g. when the upstream model fails partway through a
+	// completion that had already started streaming tokens.
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// CreateChatCompletionStream sends a chat completion request with
+// stream:true and returns a Stream of content deltas parsed from
+// OpenRouter's text/event-stream response.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (*Stream, error) {
+	req.Stream = true
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", openRouterAPIURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	c.setHeaders(httpReq)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if err := c.handleError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	stream := &Stream{events: make(chan StreamEvent)}
+	go stream.consume(resp.Body)
+
+	return stream, nil
+}
+
+func (s *Stream) consume(body io.ReadCloser) {
+	defer close(s.events)
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return
+		}
+		if data == "" {
+			continue
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			s.events <- StreamEvent{Err: fmt.Errorf("failed to parse stream frame: %w", err)}
+			return
+		}
+		if chunk.Error != nil {
+			s.events <- StreamEvent{Err: fmt.Errorf("openrouter stream error: %s", chunk.Error.Message)}
+			return
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		s.events <- StreamEvent{Delta: chunk.Choices[0].Delta.Content}
+	}
+
+	if err := scanner.Err(); err != nil {
+		s.events <- StreamEvent{Err: fmt.Errorf("stream read error: %w", err)}
+	}
+}
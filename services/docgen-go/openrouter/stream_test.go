@@ -0,0 +1,91 @@
+package openrouter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateChatCompletionStream(t *testing.T) {
+	t.Run("mid-stream error frame surfaces as StreamEvent.Err", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"partial \"}}]}\n\n")
+			io.WriteString(w, "data: {\"error\":{\"message\":\"upstream model crashed\"}}\n\n")
+			flusher, ok := w.(http.Flusher)
+			if ok {
+				flusher.Flush()
+			}
+		}))
+		defer server.Close()
+
+		originalURL := openRouterAPIURL
+		openRouterAPIURL = server.URL
+		defer func() { openRouterAPIURL = originalURL }()
+
+		client, err := NewClient()
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		stream, err := client.CreateChatCompletionStream(context.Background(), ChatRequest{})
+		if err != nil {
+			t.Fatalf("Expected no error starting the stream, got %v", err)
+		}
+
+		var deltas []string
+		var streamErr error
+		for ev := range stream.Events() {
+			if ev.Err != nil {
+				streamErr = ev.Err
+				continue
+			}
+			deltas = append(deltas, ev.Delta)
+		}
+
+		if len(deltas) != 1 || deltas[0] != "partial " {
+			t.Errorf("Expected one delta 'partial ', got %v", deltas)
+		}
+		if streamErr == nil {
+			t.Fatal("Expected the mid-stream error frame to surface as a StreamEvent.Err")
+		}
+		if !strings.Contains(streamErr.Error(), "upstream model crashed") {
+			t.Errorf("Expected error to mention the upstream message, got %v", streamErr)
+		}
+	})
+
+	t.Run("[DONE] sentinel ends the stream cleanly", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		originalURL := openRouterAPIURL
+		openRouterAPIURL = server.URL
+		defer func() { openRouterAPIURL = originalURL }()
+
+		client, _ := NewClient()
+		stream, err := client.CreateChatCompletionStream(context.Background(), ChatRequest{})
+		if err != nil {
+			t.Fatalf("Expected no error starting the stream, got %v", err)
+		}
+
+		var deltas []string
+		for ev := range stream.Events() {
+			if ev.Err != nil {
+				t.Fatalf("Expected no error, got %v", ev.Err)
+			}
+			deltas = append(deltas, ev.Delta)
+		}
+		if len(deltas) != 1 || deltas[0] != "hi" {
+			t.Errorf("Expected one delta 'hi', got %v", deltas)
+		}
+	})
+}
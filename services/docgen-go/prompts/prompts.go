@@ -1,11 +1,18 @@
 package prompts
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
 )
 
 // Prompt defines the structure for a prompt template.
@@ -18,64 +25,236 @@ type Prompt struct {
 	Tags        []string `json:"tags"`
 }
 
-var (
-	promptStore map[string]Prompt
-	once        sync.Once
-	loadErr     error
-)
+// knownOutputs is the allow-list of keys a Prompt's Outputs may
+// reference, matching handlers.FullResponse's fields one-for-one so a
+// typo in a prompt file can't silently produce a field nothing reads.
+var knownOutputs = map[string]bool{
+	"summary_md":    true,
+	"plan_md":       true,
+	"design_md":     true,
+	"diagrams":      true,
+	"risks_md":      true,
+	"acceptance_md": true,
+	"testing_md":    true,
+	"api_md":        true,
+	"data_model_md": true,
+	"capacity_md":   true,
+	"breakdown_md":  true,
+	"tradeoffs_md":  true,
+}
 
-// LoadPrompts loads all prompt templates from the given directory.
-// It's safe for concurrent use.
-func LoadPrompts(dir string) error {
-	once.Do(func() {
-		promptStore = make(map[string]Prompt)
-		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
-		if err != nil {
-			loadErr = fmt.Errorf("failed to find prompt files: %w", err)
-			return
-		}
+// Registry holds the current set of loaded prompts behind an
+// atomic.Pointer so Watch can hot-swap it without readers needing a lock.
+type Registry struct {
+	prompts atomic.Pointer[map[string]Prompt]
+}
 
-		if len(files) == 0 {
-			loadErr = fmt.Errorf("no prompt files found in directory: %s", dir)
-			return
-		}
+// NewRegistry creates an empty Registry. Call Load (and, to pick up
+// changes without a restart, Watch) before Get.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
 
-		for _, file := range files {
-			data, err := os.ReadFile(file)
-			if err != nil {
-				loadErr = fmt.Errorf("failed to read prompt file %s: %w", file, err)
-				return
-			}
+// Load reads every prompt file in dir, validates each one, and swaps
+// them in as a single atomic unit. A single invalid file fails the
+// whole load, so a typo at startup is caught immediately rather than
+// producing a partially-populated registry.
+func (r *Registry) Load(dir string) error {
+	loaded, err := loadDir(dir)
+	if err != nil {
+		return err
+	}
+	r.prompts.Store(&loaded)
+	return nil
+}
 
-			var p Prompt
-			if err := json.Unmarshal(data, &p); err != nil {
-				loadErr = fmt.Errorf("failed to unmarshal prompt file %s: %w", file, err)
-				return
-			}
+// Watch starts an fsnotify watcher on dir and reloads individual files
+// as they're created, written, or renamed into place, so prompt authors
+// don't have to restart the service to pick up a change. It returns
+// once the watcher is established; reloading happens in the background
+// until ctx is canceled.
+func (r *Registry) Watch(ctx context.Context, dir string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create prompt watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch prompt directory %s: %w", dir, err)
+	}
 
-			if p.ID == "" {
-				loadErr = fmt.Errorf("prompt file %s has no ID", file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isPromptFile(event.Name) || event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					continue
+				}
+				r.reloadFile(event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("prompt watcher error", "error", err)
 			}
-			promptStore[p.ID] = p
 		}
-	})
-	return loadErr
+	}()
+
+	return nil
 }
 
-// GetPrompt returns a prompt by its ID.
-// It returns an error if the prompt is not found or if loading failed.
-func GetPrompt(id string) (Prompt, error) {
-	if loadErr != nil {
-		return Prompt{}, fmt.Errorf("failed to load prompts: %w", loadErr)
+// reloadFile re-validates a single file and swaps it into the current
+// prompt set, leaving every other prompt untouched. On validation
+// failure the previous version is kept and the error is logged, since
+// Watch runs unattended and a bad save shouldn't take a prompt offline.
+func (r *Registry) reloadFile(path string) {
+	p, err := loadFile(path)
+	if err != nil {
+		slog.Error("failed to reload prompt file, keeping previous version", "file", path, "error", err)
+		return
 	}
-	if promptStore == nil {
-		return Prompt{}, fmt.Errorf("prompts have not been loaded")
+	if err := validate(p); err != nil {
+		slog.Error("prompt failed validation, keeping previous version", "file", path, "error", err)
+		return
+	}
+
+	for {
+		current := r.prompts.Load()
+		next := make(map[string]Prompt, len(derefOrEmpty(current))+1)
+		for id, existing := range derefOrEmpty(current) {
+			next[id] = existing
+		}
+		next[p.ID] = p
+		if r.prompts.CompareAndSwap(current, &next) {
+			slog.Info("reloaded prompt", "id", p.ID, "file", path)
+			return
+		}
 	}
+}
 
-	p, ok := promptStore[id]
+// Get returns a prompt by its ID.
+func (r *Registry) Get(id string) (Prompt, error) {
+	current := r.prompts.Load()
+	if current == nil {
+		return Prompt{}, fmt.Errorf("prompts have not been loaded")
+	}
+	p, ok := (*current)[id]
 	if !ok {
 		return Prompt{}, fmt.Errorf("prompt with id '%s' not found", id)
 	}
 	return p, nil
 }
+
+func derefOrEmpty(m *map[string]Prompt) map[string]Prompt {
+	if m == nil {
+		return nil
+	}
+	return *m
+}
+
+func isPromptFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+func loadDir(dir string) (map[string]Prompt, error) {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find prompt files: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no prompt files found in directory: %s", dir)
+	}
+
+	loaded := make(map[string]Prompt, len(files))
+	for _, file := range files {
+		p, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := validate(p); err != nil {
+			return nil, fmt.Errorf("prompt file %s failed validation: %w", file, err)
+		}
+		if _, exists := loaded[p.ID]; exists {
+			return nil, fmt.Errorf("duplicate prompt id %q (file %s)", p.ID, file)
+		}
+		loaded[p.ID] = p
+	}
+	return loaded, nil
+}
+
+func loadFile(path string) (Prompt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Prompt{}, fmt.Errorf("failed to read prompt file %s: %w", path, err)
+	}
+
+	var p Prompt
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &p); err != nil {
+			return Prompt{}, fmt.Errorf("failed to unmarshal prompt file %s: %w", path, err)
+		}
+	default:
+		if err := json.Unmarshal(data, &p); err != nil {
+			return Prompt{}, fmt.Errorf("failed to unmarshal prompt file %s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// validate checks a Prompt against the rules a file must satisfy before
+// it's allowed to (re)join the registry: a non-empty ID and Template,
+// well-formed Go template syntax, and every Outputs entry drawn from
+// the set of fields FullResponse actually has.
+func validate(p Prompt) error {
+	if p.ID == "" {
+		return fmt.Errorf("prompt has no id")
+	}
+	if strings.TrimSpace(p.Template) == "" {
+		return fmt.Errorf("prompt %q has an empty template", p.ID)
+	}
+	if _, err := template.New(p.ID).Parse(p.Template); err != nil {
+		return fmt.Errorf("prompt %q has malformed template syntax: %w", p.ID, err)
+	}
+	for _, output := range p.Outputs {
+		if !knownOutputs[output] {
+			return fmt.Errorf("prompt %q has unknown output key %q", p.ID, output)
+		}
+	}
+	return nil
+}
+
+var defaultRegistry = NewRegistry()
+
+// LoadPrompts loads every prompt template from dir into the package's
+// default Registry. It's safe for concurrent use.
+func LoadPrompts(dir string) error {
+	return defaultRegistry.Load(dir)
+}
+
+// Watch starts hot-reloading the package's default Registry from dir,
+// picking up individual file changes without requiring a restart.
+func Watch(ctx context.Context, dir string) error {
+	return defaultRegistry.Watch(ctx, dir)
+}
+
+// GetPrompt returns a prompt by its ID from the package's default Registry.
+// It returns an error if the prompt is not found or if loading failed.
+func GetPrompt(id string) (Prompt, error) {
+	return defaultRegistry.Get(id)
+}
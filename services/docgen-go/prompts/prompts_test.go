@@ -0,0 +1,102 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePromptFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write prompt fixture %s: %v", name, err)
+	}
+}
+
+func TestRegistryLoad(t *testing.T) {
+	dir := t.TempDir()
+	writePromptFile(t, dir, "summary.json", `{"id":"summary","template":"Summarize: {{.Input}}","outputs":["summary_md"]}`)
+	writePromptFile(t, dir, "design.yaml", "id: design\ntemplate: \"Design: {{.Input}}\"\noutputs:\n  - design_md\n")
+
+	r := NewRegistry()
+	if err := r.Load(dir); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	p, err := r.Get("summary")
+	if err != nil {
+		t.Fatalf("Get(summary) failed: %v", err)
+	}
+	if p.Template != "Summarize: {{.Input}}" {
+		t.Errorf("unexpected template: %q", p.Template)
+	}
+
+	if _, err := r.Get("design"); err != nil {
+		t.Errorf("expected yaml prompt file to load, got error: %v", err)
+	}
+
+	if _, err := r.Get("missing"); err == nil {
+		t.Error("expected error for unknown prompt id")
+	}
+}
+
+func TestRegistryLoadRejectsBadPrompt(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"no id", `{"template":"hello"}`},
+		{"empty template", `{"id":"x","template":""}`},
+		{"bad template syntax", `{"id":"x","template":"{{.Unclosed"}`},
+		{"unknown output", `{"id":"x","template":"hi","outputs":["not_a_real_field"]}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePromptFile(t, dir, "bad.json", tc.content)
+
+			r := NewRegistry()
+			if err := r.Load(dir); err == nil {
+				t.Error("expected Load to reject invalid prompt file")
+			}
+		})
+	}
+}
+
+func TestRegistryReloadFileKeepsPreviousOnValidationFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "summary.json")
+	writePromptFile(t, dir, "summary.json", `{"id":"summary","template":"v1","outputs":["summary_md"]}`)
+
+	r := NewRegistry()
+	if err := r.Load(dir); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"id":"summary","template":""}`), 0644); err != nil {
+		t.Fatalf("failed to overwrite fixture: %v", err)
+	}
+	r.reloadFile(path)
+
+	p, err := r.Get("summary")
+	if err != nil {
+		t.Fatalf("Get(summary) failed after bad reload: %v", err)
+	}
+	if p.Template != "v1" {
+		t.Errorf("expected previous template to survive a failed reload, got %q", p.Template)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"id":"summary","template":"v2","outputs":["summary_md"]}`), 0644); err != nil {
+		t.Fatalf("failed to overwrite fixture: %v", err)
+	}
+	r.reloadFile(path)
+
+	p, err = r.Get("summary")
+	if err != nil {
+		t.Fatalf("Get(summary) failed after good reload: %v", err)
+	}
+	if p.Template != "v2" {
+		t.Errorf("expected reload to pick up new template, got %q", p.Template)
+	}
+}
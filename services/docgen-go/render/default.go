@@ -0,0 +1,20 @@
+package render
+
+import "os"
+
+// NewDefaultRegistry builds a Registry with the standard Mermaid,
+// PlantUML, and Graphviz renderers. PlantUML is only registered when
+// PLANTUML_SERVER_URL is set, since unlike mmdc/dot it has no reasonable
+// local default.
+func NewDefaultRegistry() *Registry {
+	reg := NewRegistry()
+	reg.Register("mermaid", NewMermaidRenderer())
+	reg.Register("dot", NewGraphvizRenderer())
+	reg.Register("graphviz", NewGraphvizRenderer())
+
+	if serverURL := os.Getenv("PLANTUML_SERVER_URL"); serverURL != "" {
+		reg.Register("plantuml", NewPlantUMLRenderer(serverURL))
+	}
+
+	return reg
+}
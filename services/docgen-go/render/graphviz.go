@@ -0,0 +1,42 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// GraphvizRenderer rasterizes Graphviz DOT source by shelling out to the
+// `dot` binary.
+type GraphvizRenderer struct {
+	// BinPath is the path to the dot executable. Defaults to "dot" on
+	// PATH if empty.
+	BinPath string
+}
+
+// NewGraphvizRenderer creates a GraphvizRenderer using dot from PATH.
+func NewGraphvizRenderer() *GraphvizRenderer {
+	return &GraphvizRenderer{BinPath: "dot"}
+}
+
+// Render pipes d.Code into `dot -Tpng` and returns the rendered PNG.
+func (r *GraphvizRenderer) Render(ctx context.Context, d Diagram) ([]byte, string, error) {
+	binPath := r.BinPath
+	if binPath == "" {
+		binPath = "dot"
+	}
+
+	cmd := exec.CommandContext(ctx, binPath, "-Tpng")
+	cmd.Stdin = bytes.NewBufferString(d.Code)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("dot failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	return stdout.Bytes(), "image/png", nil
+}
@@ -0,0 +1,59 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// MermaidRenderer rasterizes Mermaid diagrams via the headless
+// mermaid-cli (`mmdc`) binary.
+type MermaidRenderer struct {
+	// BinPath is the path to the mmdc executable. Defaults to "mmdc" on
+	// PATH if empty.
+	BinPath string
+}
+
+// NewMermaidRenderer creates a MermaidRenderer using mmdc from PATH.
+func NewMermaidRenderer() *MermaidRenderer {
+	return &MermaidRenderer{BinPath: "mmdc"}
+}
+
+// Render shells out to mmdc, feeding it the diagram source via a temp
+// file and reading back the rendered PNG.
+func (r *MermaidRenderer) Render(ctx context.Context, d Diagram) ([]byte, string, error) {
+	binPath := r.BinPath
+	if binPath == "" {
+		binPath = "mmdc"
+	}
+
+	dir, err := os.MkdirTemp("", "mermaid-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	inPath := filepath.Join(dir, "input.mmd")
+	outPath := filepath.Join(dir, "output.png")
+
+	if err := os.WriteFile(inPath, []byte(d.Code), 0644); err != nil {
+		return nil, "", fmt.Errorf("write mermaid source: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, binPath, "-i", inPath, "-o", outPath, "-b", "white")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("mmdc failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("read rendered mermaid output: %w", err)
+	}
+
+	return data, "image/png", nil
+}
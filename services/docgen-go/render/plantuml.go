@@ -0,0 +1,58 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// PlantUMLRenderer renders PlantUML diagrams by POSTing the raw diagram
+// source to a PlantUML server's "/png/form" text-diagram endpoint. It
+// trades the server's compact-URL encoding scheme for a plain POST body,
+// which recent PlantUML server versions accept directly.
+type PlantUMLRenderer struct {
+	ServerURL  string // e.g. "http://localhost:8081"
+	HTTPClient *http.Client
+}
+
+// NewPlantUMLRenderer creates a PlantUMLRenderer pointed at the given
+// PlantUML server URL.
+func NewPlantUMLRenderer(serverURL string) *PlantUMLRenderer {
+	return &PlantUMLRenderer{
+		ServerURL:  strings.TrimRight(serverURL, "/"),
+		HTTPClient: &http.Client{},
+	}
+}
+
+// Render posts d.Code to the configured PlantUML server and returns the
+// rendered PNG.
+func (r *PlantUMLRenderer) Render(ctx context.Context, d Diagram) ([]byte, string, error) {
+	if r.ServerURL == "" {
+		return nil, "", fmt.Errorf("plantuml renderer has no ServerURL configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.ServerURL+"/png/form", strings.NewReader(d.Code))
+	if err != nil {
+		return nil, "", fmt.Errorf("build plantuml request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("call plantuml server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("plantuml server returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read plantuml response: %w", err)
+	}
+
+	return data, "image/png", nil
+}
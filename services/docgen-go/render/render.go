@@ -0,0 +1,68 @@
+// Package render converts the diagram sources carried on a docgen bundle
+// (Mermaid, PlantUML, Graphviz DOT, ...) into raster or vector images that
+// can be embedded in an exported PDF or shipped alongside the markdown in
+// a zip bundle.
+package render
+
+import (
+	"context"
+	"fmt"
+)
+
+// Diagram is the subset of handlers.Diagram the render package needs. It
+// is a separate type (rather than importing handlers.Diagram) so this
+// package stays a leaf dependency with no import cycle back to handlers.
+type Diagram struct {
+	ID       string
+	Type     string
+	Language string
+	Title    string
+	Code     string
+}
+
+// Renderer turns a diagram's source code into an image.
+type Renderer interface {
+	// Render returns the rendered image bytes and its MIME type (e.g.
+	// "image/png" or "image/svg+xml").
+	Render(ctx context.Context, d Diagram) ([]byte, string, error)
+}
+
+// Registry selects a Renderer by Diagram.Language and falls back to a
+// fenced code block when no renderer is registered for that language.
+type Registry struct {
+	renderers map[string]Renderer
+}
+
+// NewRegistry creates an empty registry. Use Register to add renderers.
+func NewRegistry() *Registry {
+	return &Registry{renderers: make(map[string]Renderer)}
+}
+
+// Register associates a renderer with a diagram language, e.g. "mermaid".
+func (reg *Registry) Register(language string, r Renderer) {
+	reg.renderers[language] = r
+}
+
+// Render renders d using the registered renderer for d.Language. If no
+// renderer is registered, it falls back to a fenced code block so the
+// diagram source is still visible in the output rather than dropped.
+func (reg *Registry) Render(ctx context.Context, d Diagram) ([]byte, string, error) {
+	r, ok := reg.renderers[d.Language]
+	if !ok {
+		return fallbackCodeBlock(d), "text/markdown", nil
+	}
+
+	data, mime, err := r.Render(ctx, d)
+	if err != nil {
+		return nil, "", fmt.Errorf("render %s diagram %q: %w", d.Language, d.ID, err)
+	}
+	return data, mime, nil
+}
+
+func fallbackCodeBlock(d Diagram) []byte {
+	lang := d.Language
+	if lang == "" {
+		lang = "text"
+	}
+	return []byte(fmt.Sprintf("```%s\n%s\n```\n", lang, d.Code))
+}